@@ -0,0 +1,76 @@
+package goftp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithBandwidthLimit limits the transfer to bytesPerSecond on its own,
+// instead of sharing Config.BandwidthLimit with the Client's other
+// transfers. A limit of 0 exempts the transfer from throttling.
+func WithBandwidthLimit(bytesPerSecond int64) TransferOption {
+	return func(o *transferOptions) {
+		o.limiter = newBandwidthLimiter(bytesPerSecond)
+	}
+}
+
+// bandwidthLimiter throttles data connections to a number of bytes per
+// second. A single limiter can be shared by any number of connections. A
+// nil *bandwidthLimiter doesn't limit anything.
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+
+	mu sync.Mutex
+
+	// when the bytes transferred so far are paid off
+	next time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// chunkSize caps the size of a single read or write so that no one waits
+// for much more than a second at a time.
+func (l *bandwidthLimiter) chunkSize(n int) int {
+	if l != nil && int64(n) > l.bytesPerSecond {
+		return int(l.bytesPerSecond)
+	}
+	return n
+}
+
+// wait accounts for n bytes, blocking until the bytes transferred before
+// them are within the limit, or ctx is done.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.bytesPerSecond))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package goftp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimit(t *testing.T) {
+	buf := make([]byte, 50*1024)
+	randomBytes(buf)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/throttled", buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		config := goftpConfig
+		config.BandwidthLimit = 25 * 1024
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the first 25KB are free, the other 25KB take a second
+		start := time.Now()
+		got := new(bytes.Buffer)
+		if err := c.Retrieve("git-ignored/throttled", got); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+			t.Errorf("Retrieve wasn't throttled, took %s", elapsed)
+		}
+
+		if !bytes.Equal(buf, got.Bytes()) {
+			t.Error("Got wrong bytes")
+		}
+
+		// exempt from the shared limit
+		start = time.Now()
+		os.Remove("testroot/git-ignored/foo")
+		if err := c.Store("git-ignored/foo", bytes.NewReader(buf), WithBandwidthLimit(0)); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Store was throttled, took %s", elapsed)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestBandwidthLimitPerCall(t *testing.T) {
+	buf := make([]byte, 50*1024)
+	randomBytes(buf)
+
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		os.Remove("testroot/git-ignored/foo")
+		if err := c.Store("git-ignored/foo", bytes.NewReader(buf), WithBandwidthLimit(25*1024)); err != nil {
+			t.Fatal(err)
+		}
+
+		if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+			t.Errorf("Store wasn't throttled, took %s", elapsed)
+		}
+
+		stored, err := ioutil.ReadFile("testroot/git-ignored/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, stored) {
+			t.Error("Stored wrong bytes")
+		}
+	}
+}
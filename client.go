@@ -5,10 +5,12 @@
 package goftp
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"sync"
 	"time"
@@ -71,6 +73,46 @@ func (e ftpError) Message() string {
 	return e.msg
 }
 
+// ErrNotSupported is reported by errors.Is for responses saying the server
+// doesn't implement a command (500, 502 and 504).
+var ErrNotSupported = errors.New("command not supported by server")
+
+// Is makes errors.Is report fs.ErrNotExist and fs.ErrPermission for
+// responses 550 (file unavailable) and 553 (file name not allowed)
+// respectively, and ErrNotSupported for unimplemented commands. Errors
+// with a more specific cause leave it to the cause (see Unwrap).
+func (e ftpError) Is(target error) bool {
+	if e.err != nil {
+		return false
+	}
+
+	switch target {
+	case fs.ErrNotExist:
+		return e.code == replyFileError
+	case fs.ErrPermission:
+		return e.code == replyBadFileName
+	case ErrNotSupported:
+		return e.code == replyCommandSyntaxError ||
+			e.code == replyCommandNotImplemented ||
+			e.code == replyCommandNotImplementedForParameter
+	}
+	return false
+}
+
+func (e ftpError) Unwrap() error {
+	return e.err
+}
+
+// contextError returns an ftpError describing why ctx is done.
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	return ftpError{
+		err:       err,
+		timeout:   err == context.DeadlineExceeded,
+		temporary: err == context.DeadlineExceeded,
+	}
+}
+
 // TLSMode represents the FTPS connection strategy. Servers cannot support
 // both modes on the same port.
 type TLSMode int
@@ -133,6 +175,12 @@ type Config struct {
 	// server does not support "MLST"/"MLSD". Defaults to UTC.
 	ServerLocation *time.Location
 
+	// Parser for "LIST" output, used when the server does not support
+	// "MLST"/"MLSD". Defaults to detecting the Unix, DOS/IIS, VMS, MVS and
+	// OS/400 formats. Use a ListParserChain to try several parsers in turn,
+	// e.g. a parser for an unusual server followed by UnixListParser.
+	ListParser ListParser
+
 	// Enable "active" FTP data connections where the server connects to the client to
 	// establish data connections (does not work if client is behind NAT). If TLSConfig
 	// is specified, it will be used when listening for active connections.
@@ -152,6 +200,20 @@ type Config struct {
 	// Name to identify the client software to the server name. Defaults to "goftp".
 	ClientName string
 
+	// Function notified of the progress of every Retrieve and Store, unless
+	// overridden with the WithProgress option. Defaults to nil.
+	Progress ProgressFunc
+
+	// Minimum time between progress updates while data flows. Defaults to
+	// 1 second.
+	ProgressInterval time.Duration
+
+	// Maximum combined rate, in bytes per second, of all the Client's data
+	// connections, including those of directory listings. Individual
+	// transfers can use a limit of their own with the WithBandwidthLimit
+	// option. Defaults to 0 (unlimited).
+	BandwidthLimit int64
+
 	// For testing convenience.
 	stubResponses map[string]stubResponse
 }
@@ -171,6 +233,10 @@ type Client struct {
 	mu              sync.Mutex
 	t0              time.Time
 	closed          bool
+	limiter         *bandwidthLimiter
+
+	// LIST format of each host
+	listFormats map[string]*listFormat
 }
 
 // Construct and return a new client Conn, setting default config
@@ -205,6 +271,10 @@ func newClient(config Config, hosts []string) *Client {
 		config.ClientName = "goftp"
 	}
 
+	if config.ProgressInterval <= 0 {
+		config.ProgressInterval = time.Second
+	}
+
 	return &Client{
 		config:          config,
 		freeConnCh:      make(chan *persistentConn, len(hosts)*config.ConnectionsPerHost),
@@ -212,6 +282,8 @@ func newClient(config Config, hosts []string) *Client {
 		hosts:           hosts,
 		allCons:         make(map[int]*persistentConn),
 		numConnsPerHost: make(map[string]int),
+		limiter:         newBandwidthLimiter(config.BandwidthLimit),
+		listFormats:     make(map[string]*listFormat),
 	}
 }
 
@@ -260,8 +332,12 @@ func (c *Client) numOpenConns() int {
 	return numOpen
 }
 
-// Get an idle connection.
-func (c *Client) getIdleConn() (*persistentConn, error) {
+// Get an idle connection. The connection will be interrupted if ctx is done
+// before it is handed back with returnConn.
+func (c *Client) getIdleConn(ctx context.Context) (*persistentConn, error) {
+	if ctx.Err() != nil {
+		return nil, contextError(ctx)
+	}
 
 	// First check for available connections in the channel.
 Loop:
@@ -276,6 +352,7 @@ Loop:
 				c.removeConn(pconn)
 			} else {
 				c.debug("#%d was ready", pconn.idx)
+				pconn.setContext(ctx)
 				return pconn, nil
 			}
 		default:
@@ -310,20 +387,28 @@ Loop:
 
 			c.mu.Unlock()
 
-			pconn, err := c.openConn(idx, host)
+			pconn, err := c.openConn(ctx, idx, host)
 			if err != nil {
 				c.mu.Lock()
 				c.numConnsPerHost[host]--
 				c.mu.Unlock()
 				c.debug("#%d error connecting: %s", idx, err)
+				return nil, err
 			}
-			return pconn, err
+			pconn.setContext(ctx)
+			return pconn, nil
 		}
 
 		c.mu.Unlock()
 
 		// block waiting for a free connection
-		pconn := <-c.freeConnCh
+		var pconn *persistentConn
+		select {
+		case pconn = <-c.freeConnCh:
+		case <-ctx.Done():
+			c.debug("gave up waiting for a connection: %s", ctx.Err())
+			return nil, contextError(ctx)
+		}
 
 		if pconn.broken {
 			c.debug("waited and got #%d (broken)", pconn.idx)
@@ -333,8 +418,8 @@ Loop:
 			c.removeConn(pconn)
 		} else {
 			c.debug("waited and got #%d", pconn.idx)
+			pconn.setContext(ctx)
 			return pconn, nil
-
 		}
 	}
 }
@@ -347,6 +432,7 @@ func (c *Client) removeConn(pconn *persistentConn) {
 }
 
 func (c *Client) returnConn(pconn *persistentConn) {
+	pconn.clearContext()
 	c.freeConnCh <- pconn
 }
 
@@ -354,16 +440,22 @@ func (c *Client) returnConn(pconn *persistentConn) {
 // or data command you want. See the RawConn interface for more details. The RawConn will
 // not participate in the Client's pool (i.e. does not count against ConnectionsPerHost).
 func (c *Client) OpenRawConn() (RawConn, error) {
+	return c.OpenRawConnContext(context.Background())
+}
+
+// OpenRawConnContext is like OpenRawConn, but gives up opening the connection
+// if ctx is done first. Once returned, the RawConn is not bound to ctx.
+func (c *Client) OpenRawConnContext(ctx context.Context) (RawConn, error) {
 	c.mu.Lock()
 	idx := c.rawConnIdx
 	host := c.hosts[idx%len(c.hosts)]
 	c.rawConnIdx++
 	c.mu.Unlock()
-	return c.openConn(-(idx + 1), host)
+	return c.openConn(ctx, -(idx + 1), host)
 }
 
 // Open and set up a control connection.
-func (c *Client) openConn(idx int, host string) (pconn *persistentConn, err error) {
+func (c *Client) openConn(ctx context.Context, idx int, host string) (pconn *persistentConn, err error) {
 	pconn = &persistentConn{
 		idx:              idx,
 		features:         make(map[string]string),
@@ -372,26 +464,34 @@ func (c *Client) openConn(idx int, host string) (pconn *persistentConn, err erro
 		currentType:      "A",
 		host:             host,
 		epsvNotSupported: c.config.DisableEPSV,
+		ctx:              context.Background(),
+		limiter:          c.limiter,
 	}
 
-	var conn net.Conn
+	pconn.setContext(ctx)
+	defer pconn.clearContext()
+
+	var (
+		conn net.Conn
+		code int
+		msg  string
+	)
+
+	dialer := &net.Dialer{
+		Timeout: c.config.Timeout,
+	}
 
 	if c.config.TLSConfig != nil && c.config.TLSMode == TLSImplicit {
 		pconn.debug("opening TLS control connection to %s", host)
-		dialer := &net.Dialer{
-			Timeout: c.config.Timeout,
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+		if err == nil {
+			conn = tls.Client(conn, implicitTLSConfig(c.config.TLSConfig, host))
 		}
-		conn, err = tls.DialWithDialer(dialer, "tcp", host, pconn.config.TLSConfig)
 	} else {
 		pconn.debug("opening control connection to %s", host)
-		conn, err = net.DialTimeout("tcp", host, c.config.Timeout)
+		conn, err = dialer.DialContext(ctx, "tcp", host)
 	}
 
-	var (
-		code int
-		msg  string
-	)
-
 	if err != nil {
 		var isTemporary bool
 		if ne, ok := err.(net.Error); ok {
@@ -436,6 +536,12 @@ func (c *Client) openConn(idx int, host string) (pconn *persistentConn, err erro
 		}
 	}
 
+	if pconn.hasFeature("MLST") {
+		if err = pconn.setMLSTFacts(); err != nil {
+			goto Error
+		}
+	}
+
 	if pconn.hasFeature("UTF8") {
 		if err = pconn.setUnicode(); err != nil {
 			goto Error
@@ -457,5 +563,20 @@ func (c *Client) openConn(idx int, host string) (pconn *persistentConn, err erro
 
 Error:
 	pconn.close()
-	return nil, err
+	return nil, pconn.contextError(err)
+}
+
+// implicitTLSConfig returns the TLS config to use for an implicit TLS control
+// connection to host, filling in ServerName like tls.Dial does.
+func implicitTLSConfig(config *tls.Config, host string) *tls.Config {
+	if config.ServerName != "" {
+		return config
+	}
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return config
+	}
+	config = config.Clone()
+	config.ServerName = hostname
+	return config
 }
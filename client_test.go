@@ -6,6 +6,7 @@ package goftp
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"sync"
 	"testing"
@@ -71,13 +72,6 @@ func TestExplicitTLS(t *testing.T) {
 }
 
 func TestImplicitTLS(t *testing.T) {
-	closer, err := startPureFTPD(implicitTLSAddrs, "ftpd/pure-ftpd-implicittls")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	defer closer()
-
 	for _, addr := range implicitTLSAddrs {
 		config := Config{
 			TLSConfig: &tls.Config{
@@ -148,3 +142,84 @@ func TestPooling(t *testing.T) {
 		t.Error("Leaked a connection")
 	}
 }
+
+func TestGetIdleConnContext(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		config := goftpConfig
+		config.ConnectionsPerHost = 1
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// hog the only connection
+		pconn, err := c.getIdleConn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+		t0 := time.Now()
+		_, err = c.StatContext(ctx, "subdir/1234.bin")
+		delta := time.Now().Sub(t0)
+		cancel()
+
+		if err == nil || !err.(ftpError).Timeout() {
+			t.Errorf("Expected a timeout error, got %v", err)
+		}
+
+		if delta > time.Second {
+			t.Errorf("Waited %s for a connection", delta)
+		}
+
+		c.returnConn(pconn)
+
+		// connection should be usable by the next caller
+		if _, err := c.Stat("subdir/1234.bin"); err != nil {
+			t.Error(err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestOpenRawConnContext(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = c.OpenRawConnContext(ctx)
+		if err == nil || err.(ftpError).err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		rawConn, err := c.OpenRawConnContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// raw connection outlives the context it was opened with
+		cancel()
+
+		code, _, err := rawConn.SendCommand("NOOP")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != 200 {
+			t.Errorf("got %d", code)
+		}
+
+		rawConn.Close()
+	}
+}
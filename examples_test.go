@@ -9,9 +9,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
-	"github.com/crazy-max/goftp"
+	"github.com/Infiziert90/goftp"
 )
 
 func Example() {
@@ -66,6 +67,34 @@ func Example_config() {
 	}
 }
 
+func ExampleClient_Walk() {
+	client, err := goftp.Dial("ftp.hq.nasa.gov")
+	if err != nil {
+		panic(err)
+	}
+
+	err = client.Walk("", func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			// no permissions is okay, keep walking
+			if err.(goftp.Error).Code() == 550 {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		fmt.Println(fullPath)
+
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
 func ExampleClient_OpenRawConn() {
 	// ignore errors for brevity
 
@@ -6,11 +6,10 @@ package goftp
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -20,7 +19,12 @@ const timeFormat = "20060102150405"
 
 // Delete deletes the file "path".
 func (c *Client) Delete(path string) error {
-	pconn, err := c.getIdleConn()
+	return c.DeleteContext(context.Background(), path)
+}
+
+// DeleteContext is like Delete, but gives up as soon as ctx is done.
+func (c *Client) DeleteContext(ctx context.Context, path string) error {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return err
 	}
@@ -32,7 +36,12 @@ func (c *Client) Delete(path string) error {
 
 // Rename renames file "from" to "to".
 func (c *Client) Rename(from, to string) error {
-	pconn, err := c.getIdleConn()
+	return c.RenameContext(context.Background(), from, to)
+}
+
+// RenameContext is like Rename, but gives up as soon as ctx is done.
+func (c *Client) RenameContext(ctx context.Context, from, to string) error {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return err
 	}
@@ -50,7 +59,12 @@ func (c *Client) Rename(from, to string) error {
 // Mkdir creates directory "path". The returned string is how the client
 // should refer to the created directory.
 func (c *Client) Mkdir(path string) (string, error) {
-	pconn, err := c.getIdleConn()
+	return c.MkdirContext(context.Background(), path)
+}
+
+// MkdirContext is like Mkdir, but gives up as soon as ctx is done.
+func (c *Client) MkdirContext(ctx context.Context, path string) (string, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -76,7 +90,12 @@ func (c *Client) Mkdir(path string) (string, error) {
 
 // Rmdir removes directory "path".
 func (c *Client) Rmdir(path string) error {
-	pconn, err := c.getIdleConn()
+	return c.RmdirContext(context.Background(), path)
+}
+
+// RmdirContext is like Rmdir, but gives up as soon as ctx is done.
+func (c *Client) RmdirContext(ctx context.Context, path string) error {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return err
 	}
@@ -88,7 +107,12 @@ func (c *Client) Rmdir(path string) error {
 
 // Getwd returns the current working directory.
 func (c *Client) Getwd() (string, error) {
-	pconn, err := c.getIdleConn()
+	return c.GetwdContext(context.Background())
+}
+
+// GetwdContext is like Getwd, but gives up as soon as ctx is done.
+func (c *Client) GetwdContext(ctx context.Context) (string, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -120,12 +144,21 @@ func commandNotSupporterdError(err error) bool {
 // ReadDir fetches the contents of a directory, returning a list of
 // os.FileInfo's which are relatively easy to work with programatically. It
 // will not return entries corresponding to the current directory or parent
-// directories. The os.FileInfo's fields may be incomplete depending on what
-// the server supports. If the server does not support "MLSD", "LIST" will
-// be used. You may have to set ServerLocation in your config to get (more)
-// accurate ModTimes in this case.
+// directories. Symbolic links are not followed, as with Lstat. The
+// os.FileInfo's fields may be incomplete depending on what the server
+// supports. If the server does not support "MLSD", "LIST" will be used. The
+// Unix "ls -l", DOS/IIS and VMS formats are recognized on their own; MVS and
+// OS/400 listings are understood when the server's "SYST" reply names the
+// system. Set ListParser in your config for other formats. You may have to
+// set ServerLocation in your config to get (more) accurate ModTimes in this
+// case.
 func (c *Client) ReadDir(path string) ([]os.FileInfo, error) {
-	pconn, err := c.getIdleConn()
+	return c.ReadDirContext(context.Background(), path)
+}
+
+// ReadDirContext is like ReadDir, but gives up as soon as ctx is done.
+func (c *Client) ReadDirContext(ctx context.Context, path string) ([]os.FileInfo, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -151,8 +184,9 @@ func (c *Client) ReadDir(path string) ([]os.FileInfo, error) {
 		if err != nil {
 			return nil, err
 		}
+		entries = c.prepareLIST(pconn, entries)
 		parser = func(entry string, skipSelfParent bool) (os.FileInfo, error) {
-			return parseLIST(entry, c.config.ServerLocation, skipSelfParent)
+			return c.parseLISTEntry(pconn.host, entry, skipSelfParent)
 		}
 	}
 
@@ -180,13 +214,19 @@ func (c *Client) ReadDir(path string) ([]os.FileInfo, error) {
 	return ret, nil
 }
 
-// Stat fetches details for a particular file. The os.FileInfo's fields may
-// be incomplete depending on what the server supports. If the server doesn't
-// support "MLST", "LIST" will be attempted, but "LIST" will not work if path
-// is a directory. You may have to set ServerLocation in your config to get
-// (more) accurate ModTimes when using "LIST".
-func (c *Client) Stat(path string) (os.FileInfo, error) {
-	pconn, err := c.getIdleConn()
+// Lstat fetches details for a particular file. If path is a symbolic link,
+// the os.FileInfo describes the link itself (see Stat). The os.FileInfo's
+// fields may be incomplete depending on what the server supports. If the
+// server doesn't support "MLST", "LIST" will be attempted, but "LIST" will
+// not work if path is a directory. You may have to set ServerLocation in your
+// config to get (more) accurate ModTimes when using "LIST".
+func (c *Client) Lstat(path string) (os.FileInfo, error) {
+	return c.LstatContext(context.Background(), path)
+}
+
+// LstatContext is like Lstat, but gives up as soon as ctx is done.
+func (c *Client) LstatContext(ctx context.Context, path string) (os.FileInfo, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -210,11 +250,183 @@ func (c *Client) Stat(path string) (os.FileInfo, error) {
 		return nil, err
 	}
 
-	if len(lines) != 1 {
+	// skip headers and the like, such as VMS's "Directory DISK$USER:[GOFTP]",
+	// but not the "total" line of a directory listing
+	var infos []os.FileInfo
+	for _, line := range c.prepareLIST(pconn, lines) {
+		if strings.HasPrefix(line, "total ") {
+			return nil, ftpError{err: fmt.Errorf("unexpected LIST response: %v", lines)}
+		}
+
+		info, err := c.parseLISTEntry(pconn.host, line, false)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			infos = append(infos, info)
+		}
+	}
+
+	if len(infos) != 1 {
 		return nil, ftpError{err: fmt.Errorf("unexpected LIST response: %v", lines)}
 	}
 
-	return parseLIST(lines[0], c.config.ServerLocation, false)
+	return infos[0], nil
+}
+
+// ModTime returns the modification time of file "path" using the MDTM
+// command. Unlike the times ReadDir and Stat parse out of "LIST", it is
+// precise to the second even for old files.
+func (c *Client) ModTime(path string) (time.Time, error) {
+	return c.ModTimeContext(context.Background(), path)
+}
+
+// ModTimeContext is like ModTime, but gives up as soon as ctx is done.
+func (c *Client) ModTimeContext(ctx context.Context, path string) (time.Time, error) {
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	defer c.returnConn(pconn)
+
+	code, msg, err := pconn.sendCommand("MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if code != replyFileStatus {
+		return time.Time{}, ftpError{code: code, msg: msg}
+	}
+
+	// "20150102150405", possibly with fractional seconds
+	t, err := time.ParseInLocation(timeFormat, strings.SplitN(msg, ".", 2)[0], time.UTC)
+	if err != nil {
+		return time.Time{}, ftpError{err: fmt.Errorf("failed parsing MDTM response %q: %s", msg, err)}
+	}
+
+	return t, nil
+}
+
+// Chtimes sets the modification time of file "path" to mtime (truncated to
+// the second). It uses the MFMT command if the server supports it, falling
+// back to "SITE UTIME" and then to the "MDTM YYYYMMDDHHMMSS path" form some
+// older servers accept.
+func (c *Client) Chtimes(path string, mtime time.Time) error {
+	return c.ChtimesContext(context.Background(), path, mtime)
+}
+
+// ChtimesContext is like Chtimes, but gives up as soon as ctx is done.
+func (c *Client) ChtimesContext(ctx context.Context, path string, mtime time.Time) error {
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer c.returnConn(pconn)
+
+	ts := mtime.UTC().Format(timeFormat)
+
+	if pconn.hasFeature("MFMT") {
+		return pconn.sendCommandExpected(replyFileStatus, "MFMT %s %s", ts, path)
+	}
+
+	err = pconn.sendCommandExpected(replyGroupPositiveCompletion, "SITE UTIME %s %s", ts, path)
+	if err == nil || !commandNotSupporterdError(err) {
+		return err
+	}
+
+	pconn.debug("server doesn't support SITE UTIME, trying MDTM")
+
+	return pconn.sendCommandExpected(replyGroupPositiveCompletion, "MDTM %s %s", ts, path)
+}
+
+// Chmod changes the mode of file "path" to mode using "SITE CHMOD". Besides
+// the permission bits, mode may include os.ModeSetuid, os.ModeSetgid and
+// os.ModeSticky. The returned error matches ErrNotSupported if the server
+// doesn't support "SITE CHMOD", and fs.ErrNotExist or fs.ErrPermission
+// (see errors.Is) if the server says the file doesn't exist or can't be
+// changed.
+func (c *Client) Chmod(path string, mode os.FileMode) error {
+	return c.ChmodContext(context.Background(), path, mode)
+}
+
+// ChmodContext is like Chmod, but gives up as soon as ctx is done.
+func (c *Client) ChmodContext(ctx context.Context, path string, mode os.FileMode) error {
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer c.returnConn(pconn)
+
+	code, msg, err := pconn.sendCommand("SITE CHMOD %04o %s", unixMode(mode), path)
+	if err != nil {
+		return err
+	}
+
+	if !positiveCompletionReply(code) {
+		return chmodError(path, code, msg)
+	}
+
+	return nil
+}
+
+// chmodError classifies a failed "SITE CHMOD". Servers answer 550 both for
+// missing files and for files the user may not change, so the message
+// decides.
+func chmodError(path string, code int, msg string) error {
+	var cause error
+
+	lower := strings.ToLower(msg)
+	switch {
+	case code == replyBadFileName,
+		code == replyFileError && (strings.Contains(lower, "permission") || strings.Contains(lower, "not permitted")):
+		cause = fs.ErrPermission
+	case code == replyFileError:
+		cause = fs.ErrNotExist
+	case code == replyCommandSyntaxError, code == replyCommandNotImplemented, code == replyCommandNotImplementedForParameter:
+		cause = ErrNotSupported
+	default:
+		return ftpError{code: code, msg: msg}
+	}
+
+	return ftpError{
+		err:  &fs.PathError{Op: "chmod", Path: path, Err: fmt.Errorf("%w (%d-%s)", cause, code, msg)},
+		code: code,
+		msg:  msg,
+	}
+}
+
+// unixMode converts mode's permission bits to the octal form used by chmod
+// and the "UNIX.mode" fact.
+func unixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// fileMode is the inverse of unixMode.
+func fileMode(bits uint32) os.FileMode {
+	mode := os.FileMode(bits).Perm()
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
 }
 
 func extractDirName(msg string) (string, error) {
@@ -304,12 +516,27 @@ func (c *Client) dataStringList(pconn *persistentConn, f string, args ...interfa
 	return res, nil
 }
 
+// LinkInfo is implemented by the os.FileInfo's returned by ReadDir and
+// Lstat. LinkTarget returns the target of a symbolic link if the server
+// listed it ("name -> target" in "LIST" output, "OS.unix=slink:target" in
+// "MLST" output), or an empty string.
+type LinkInfo interface {
+	os.FileInfo
+	LinkTarget() string
+}
+
 type ftpFile struct {
 	name  string
 	size  int64
 	mode  os.FileMode
 	mtime time.Time
 	raw   string
+
+	// symlink target, if known
+	link string
+
+	// facts of MLST entries
+	sys *MLSTFacts
 }
 
 func (f *ftpFile) Name() string {
@@ -332,79 +559,15 @@ func (f *ftpFile) IsDir() bool {
 	return f.mode.IsDir()
 }
 
+// Sys returns an *MLSTFacts for entries from "MLST"/"MLSD", or the raw
+// entry string for entries from "LIST".
 func (f *ftpFile) Sys() interface{} {
+	if f.sys != nil {
+		return f.sys
+	}
 	return f.raw
 }
 
-var lsRegex = regexp.MustCompile(`^\s*(\S)(\S{3})(\S{3})(\S{3})(?:\s+\S+){3}\s+(\d+)\s+(\w+\s+\d+)\s+([\d:]+)\s+(.+)$`)
-
-// total 404456
-// drwxr-xr-x   8 goftp    20            272 Jul 28 05:03 git-ignored
-func parseLIST(entry string, loc *time.Location, skipSelfParent bool) (os.FileInfo, error) {
-	if strings.HasPrefix(entry, "total ") {
-		return nil, nil
-	}
-
-	matches := lsRegex.FindStringSubmatch(entry)
-	if len(matches) == 0 {
-		return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry: %s`, entry)}
-	}
-
-	if skipSelfParent && (matches[8] == "." || matches[8] == "..") {
-		return nil, nil
-	}
-
-	var mode os.FileMode
-	switch matches[1] {
-	case "d":
-		mode |= os.ModeDir
-	case "l":
-		mode |= os.ModeSymlink
-	}
-
-	for i := 0; i < 3; i++ {
-		if matches[i+2][0] == 'r' {
-			mode |= os.FileMode(04 << (3 * uint(2-i)))
-		}
-		if matches[i+2][1] == 'w' {
-			mode |= os.FileMode(02 << (3 * uint(2-i)))
-		}
-		if matches[i+2][2] == 'x' || matches[i+2][2] == 's' {
-			mode |= os.FileMode(01 << (3 * uint(2-i)))
-		}
-	}
-
-	size, err := strconv.ParseUint(matches[5], 10, 64)
-	if err != nil {
-		return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's size: %s (%s)`, err, entry)}
-	}
-
-	var mtime time.Time
-	if strings.Contains(matches[7], ":") {
-		mtime, err = time.ParseInLocation("Jan _2 15:04", matches[6]+" "+matches[7], loc)
-		if err == nil {
-			now := time.Now()
-			year := now.Year()
-			if mtime.Month() > now.Month() {
-				year--
-			}
-			mtime, err = time.ParseInLocation("Jan _2 15:04 2006", matches[6]+" "+matches[7]+" "+strconv.Itoa(year), loc)
-		}
-	} else {
-		mtime, err = time.ParseInLocation("Jan _2 2006", matches[6]+" "+matches[7], loc)
-	}
-
-	if err != nil {
-		return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's mtime: %s (%s)`, err, entry)}
-	}
-
-	info := &ftpFile{
-		name:  filepath.Base(matches[8]),
-		mode:  mode,
-		mtime: mtime,
-		raw:   entry,
-		size:  int64(size),
-	}
-
-	return info, nil
+func (f *ftpFile) LinkTarget() string {
+	return f.link
 }
@@ -6,14 +6,20 @@ package goftp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Infiziert90/goftp/goftptest"
 )
 
 func TestDelete(t *testing.T) {
@@ -199,7 +205,7 @@ func TestReadDir(t *testing.T) {
 			}
 
 			if err := compareFileInfos(item, expected); err != nil {
-				t.Errorf("mismatch on %s: %s (%s)", item.Name(), err, item.Sys().(string))
+				t.Errorf("mismatch on %s: %s (%s)", item.Name(), err, item.Sys())
 			}
 
 			names = append(names, item.Name())
@@ -218,8 +224,7 @@ func TestReadDir(t *testing.T) {
 }
 
 func TestReadDirNoMLSD(t *testing.T) {
-	// pureFTPD seems to have some issues with timestamps in LIST output
-	for _, addr := range proAddrs {
+	for _, addr := range ftpdAddrs {
 		config := goftpConfig
 		config.stubResponses = map[string]stubResponse{
 			"MLSD ": {500, "'MLSD ': command not understood."},
@@ -250,7 +255,7 @@ func TestReadDirNoMLSD(t *testing.T) {
 			}
 
 			if err := compareFileInfos(item, expected); err != nil {
-				t.Errorf("mismatch on %s: %s (%s)", item.Name(), err, item.Sys().(string))
+				t.Errorf("mismatch on %s: %s (%s)", item.Name(), err, item.Sys())
 			}
 
 			names = append(names, item.Name())
@@ -334,8 +339,7 @@ func TestStat(t *testing.T) {
 }
 
 func TestStatNoMLST(t *testing.T) {
-	// pureFTPD seems to have some issues with timestamps in LIST output
-	for _, addr := range proAddrs {
+	for _, addr := range ftpdAddrs {
 		config := goftpConfig
 		config.stubResponses = map[string]stubResponse{
 			"MLST ":                {500, "'MLST ': command not understood."},
@@ -398,7 +402,7 @@ func TestGetwd(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		pconn, err := c.getIdleConn()
+		pconn, err := c.getIdleConn(context.Background())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -420,3 +424,418 @@ func TestGetwd(t *testing.T) {
 		}
 	}
 }
+
+func TestModTime(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mtime, err := c.ModTime("subdir/1234.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat("testroot/subdir/1234.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !mtime.Equal(info.ModTime().Truncate(time.Second)) {
+			t.Errorf("Got %s, expected %s", mtime, info.ModTime())
+		}
+
+		_, err = c.ModTime("doesnt-exist")
+		if err == nil || err.(Error).Code() != 550 {
+			t.Errorf("Expected 550, got %v", err)
+		}
+	}
+}
+
+func TestChtimes(t *testing.T) {
+	// MFMT, SITE UTIME and MDTM in turn
+	for _, disabled := range [][]string{nil, {"MFMT"}, {"MFMT", "SITE UTIME"}} {
+		server := goftptest.NewUnstartedServer(goftptest.Dir("testroot"))
+		server.Disabled = disabled
+		server.Start()
+
+		c, err := Dial(server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile("testroot/git-ignored/foo", []byte{1, 2, 3, 4}, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		mtime := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+
+		if err := c.Chtimes("git-ignored/foo", mtime); err != nil {
+			t.Fatalf("disabled %v: %s", disabled, err)
+		}
+
+		info, err := os.Stat("testroot/git-ignored/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("disabled %v: got %s", disabled, info.ModTime())
+		}
+
+		got, err := c.ModTime("git-ignored/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !got.Equal(mtime) {
+			t.Errorf("disabled %v: got %s", disabled, got)
+		}
+
+		c.Close()
+		server.Close()
+	}
+}
+
+func TestChmod(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile("testroot/git-ignored/foo", []byte{1, 2, 3, 4}, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, mode := range []os.FileMode{0755, 0600, 0750 | os.ModeSetgid, 0700 | os.ModeSetuid | os.ModeSticky} {
+			if err := c.Chmod("git-ignored/foo", mode); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat("testroot/git-ignored/foo")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Mode() != mode {
+				t.Errorf("Got %s, expected %s", info.Mode(), mode)
+			}
+
+			// the mode should round-trip through MLST and LIST
+			for _, fn := range []func(string) (os.FileInfo, error){c.Stat, listStat(c)} {
+				info, err := fn("git-ignored/foo")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if info.Mode() != mode {
+					t.Errorf("Got %s, expected %s", info.Mode(), mode)
+				}
+			}
+		}
+
+		err = c.Chmod("doesnt-exist", 0644)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected fs.ErrNotExist, got %v", err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+// listStat stats a file using LIST.
+func listStat(c *Client) func(string) (os.FileInfo, error) {
+	return func(path string) (os.FileInfo, error) {
+		pconn, err := c.getIdleConn(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		defer c.returnConn(pconn)
+
+		lines, err := c.dataStringList(pconn, "LIST %s", path)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseLIST(lines[0], time.UTC)
+	}
+}
+
+func TestChmodNotSupported(t *testing.T) {
+	server := goftptest.NewUnstartedServer(goftptest.NewMemFS())
+	server.Disabled = []string{"SITE CHMOD"}
+	server.Start()
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Chmod("foo", 0644)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestChmodError(t *testing.T) {
+	cases := []struct {
+		code   int
+		msg    string
+		target error
+	}{
+		{550, "foo: No such file or directory", fs.ErrNotExist},
+		{550, "foo: Operation not permitted", fs.ErrPermission},
+		{550, "Permission denied.", fs.ErrPermission},
+		{553, "Not allowed.", fs.ErrPermission},
+		{502, "SITE CHMOD not implemented.", ErrNotSupported},
+		{500, "Unknown SITE command.", ErrNotSupported},
+	}
+
+	for _, c := range cases {
+		err := chmodError("foo", c.code, c.msg)
+		if !errors.Is(err, c.target) {
+			t.Errorf("%d-%s: expected %v, got %v", c.code, c.msg, c.target, err)
+		}
+
+		if err.(Error).Code() != c.code {
+			t.Errorf("%d-%s: got code %d", c.code, c.msg, err.(Error).Code())
+		}
+	}
+}
+
+func TestParseLISTMode(t *testing.T) {
+	cases := []struct {
+		perms string
+		mode  os.FileMode
+	}{
+		{"-rw-r--r--", 0644},
+		{"-rwsr-xr-x", 0755 | os.ModeSetuid},
+		{"-rwSr--r--", 0644 | os.ModeSetuid},
+		{"-rwxr-s---", 0750 | os.ModeSetgid},
+		{"-rw-r-Sr--", 0644 | os.ModeSetgid},
+		{"drwxrwxrwt", 0777 | os.ModeDir | os.ModeSticky},
+		{"drwxrwxrwT", 0776 | os.ModeDir | os.ModeSticky},
+	}
+
+	for _, c := range cases {
+		info, err := parseLIST(c.perms+"   1 goftp    20            4 Jul 28  2015 foo", time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode() != c.mode {
+			t.Errorf("%s: got %s, expected %s", c.perms, info.Mode(), c.mode)
+		}
+	}
+}
+
+func TestReadDirDOS(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("subdir/1234.bin", []byte{1, 2, 3, 4}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2015, 7, 28, 17, 3, 0, 0, time.UTC)
+	for _, name := range []string{"subdir", "subdir/1234.bin"} {
+		if err := fs.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := goftptest.NewUnstartedServer(fs)
+	server.Disabled = []string{"MLST"}
+	server.ListLine = func(info os.FileInfo) string {
+		size := fmt.Sprintf("%20d", info.Size())
+		if info.IsDir() {
+			size = fmt.Sprintf("%-20s", "      <DIR>")
+		}
+		return fmt.Sprintf("%s %s %s", info.ModTime().Format("01-02-06  03:04PM"), size, info.Name())
+	}
+	server.Start()
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	list, err := c.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Name() != "subdir" || !list[0].IsDir() || !list[0].ModTime().Equal(mtime) {
+		t.Errorf("got %v", list)
+	}
+
+	info, err := c.Stat("subdir/1234.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "1234.bin" || info.Size() != 4 || info.IsDir() || !info.ModTime().Equal(mtime) {
+		t.Errorf("got %s %d %s", info.Name(), info.Size(), info.ModTime())
+	}
+}
+
+func TestReadDirVMS(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("a_very_long_file_name.txt", make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("subdir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2015, 7, 28, 17, 3, 4, 0, time.UTC)
+	for _, name := range []string{"subdir", "a_very_long_file_name.txt"} {
+		if err := fs.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := goftptest.NewUnstartedServer(fs)
+	server.Disabled = []string{"MLST"}
+	server.System = "VMS OpenVMS V1.4"
+	server.ListLine = func(info os.FileInfo) string {
+		name := strings.ToUpper(info.Name())
+		if info.IsDir() {
+			name += ".DIR"
+		}
+		// long names get a line of their own
+		return fmt.Sprintf("%s;1\r\n%25d/%d  %s  [GOFTP]  (RWED,RWED,RE,)",
+			name, (info.Size()+511)/512, 3, strings.ToUpper(info.ModTime().Format("2-Jan-2006 15:04:05")))
+	}
+	server.Start()
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	list, err := c.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("got %v", list)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+
+	if list[0].Name() != "A_VERY_LONG_FILE_NAME.TXT" || list[0].Size() != 1024 || !list[0].ModTime().Equal(mtime) {
+		t.Errorf("got %s %d %s", list[0].Name(), list[0].Size(), list[0].ModTime())
+	}
+
+	if list[1].Name() != "SUBDIR" || !list[1].IsDir() || list[1].Mode().Perm() != 0750 {
+		t.Errorf("got %s %s", list[1].Name(), list[1].Mode())
+	}
+}
+
+func TestReadDirListParser(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("1234.bin", []byte{1, 2, 3, 4}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewUnstartedServer(fs)
+	server.Disabled = []string{"MLST", "SYST"}
+	server.ListLine = func(info os.FileInfo) string {
+		return fmt.Sprintf("FILE %s %d", info.Name(), info.Size())
+	}
+	server.Start()
+	defer server.Close()
+
+	var parsed []string
+	c, err := DialConfig(Config{
+		ListParser: ListParserFunc(func(entry string, loc *time.Location) (os.FileInfo, error) {
+			parsed = append(parsed, entry)
+
+			var (
+				name string
+				size int64
+			)
+			if _, err := fmt.Sscanf(entry, "FILE %s %d", &name, &size); err != nil {
+				return nil, err
+			}
+			return &ftpFile{name: name, size: size, mode: 0644, raw: entry}, nil
+		}),
+	}, server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	list, err := c.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].Name() != "1234.bin" || list[0].Size() != 4 {
+		t.Errorf("got %v", list)
+	}
+
+	info, err := c.Stat("1234.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "1234.bin" || info.Size() != 4 {
+		t.Errorf("got %s (%d bytes)", info.Name(), info.Size())
+	}
+
+	if len(parsed) != 2 {
+		t.Errorf("got %q", parsed)
+	}
+}
+
+func TestMLSTFacts(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("subdir/lorem.txt", []byte("lorem"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	list, err := c.ReadDir("subdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("got %v", list)
+	}
+
+	info, err := c.Stat("subdir/lorem.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "unique" is only sent when asked for with "OPTS MLST"
+	listed, ok := list[0].Sys().(*MLSTFacts)
+	if !ok || listed.Type != "file" || listed.Unique == "" || listed.Perm == "" {
+		t.Fatalf("got %#v", list[0].Sys())
+	}
+
+	stated := info.Sys().(*MLSTFacts)
+	if stated.Unique != listed.Unique {
+		t.Errorf("got %q and %q", stated.Unique, listed.Unique)
+	}
+}
@@ -0,0 +1,241 @@
+package goftp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// FS returns a file system (an fs.FS) for the tree of files rooted at the
+// directory "root" on the server. The file system also implements
+// fs.ReadDirFS, fs.StatFS and fs.ReadFileFS on top of ReadDir, Stat and
+// Retrieve. Errors are *fs.PathErrors; those caused by 550 and 553 responses
+// match fs.ErrNotExist and fs.ErrPermission respectively with errors.Is.
+//
+// Files opened through the file system are downloaded in full the first time
+// they are read, so they are best suited to modestly sized files.
+func (c *Client) FS(root string) fs.FS {
+	return &clientFS{client: c, root: root}
+}
+
+type clientFS struct {
+	client *Client
+	root   string
+}
+
+// path translates a fs.FS name to a path on the server.
+func (fsys *clientFS) path(name string) string {
+	if name == "." {
+		return fsys.root
+	}
+	return path.Join(fsys.root, name)
+}
+
+func (fsys *clientFS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &fsDir{fsys: fsys, name: name, info: info}, nil
+	}
+
+	return &fsFile{fsys: fsys, name: name, info: info}, nil
+}
+
+func (fsys *clientFS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+func (fsys *clientFS) stat(op, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := fsys.client.Stat(fsys.path(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	// servers disagree about what to call the file in a MLST response
+	return namedFileInfo{info, path.Base(name)}, nil
+}
+
+func (fsys *clientFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	infos, err := fsys.client.ReadDir(fsys.path(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = dirEntry{info}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (fsys *clientFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := fsys.client.Retrieve(fsys.path(name), buf); err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+
+	return buf.Bytes(), nil
+}
+
+type namedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (info namedFileInfo) Name() string {
+	return info.name
+}
+
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (d dirEntry) Name() string               { return d.info.Name() }
+func (d dirEntry) IsDir() bool                { return d.info.IsDir() }
+func (d dirEntry) Type() fs.FileMode          { return d.info.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.info, nil }
+
+// fsFile is a regular file opened through clientFS. Its contents are
+// retrieved on first use.
+type fsFile struct {
+	fsys   *clientFS
+	name   string
+	info   fs.FileInfo
+	r      *bytes.Reader
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsFile) load(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+
+	if f.r != nil {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	if err := f.fsys.client.Retrieve(f.fsys.path(f.name), buf); err != nil {
+		return &fs.PathError{Op: op, Path: f.name, Err: err}
+	}
+
+	f.r = bytes.NewReader(buf.Bytes())
+	return nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+	return f.r.Read(p)
+}
+
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.load("read"); err != nil {
+		return 0, err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load("seek"); err != nil {
+		return 0, err
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	f.r = nil
+	return nil
+}
+
+// fsDir is a directory opened through clientFS. Its entries are listed on
+// first use.
+type fsDir struct {
+	fsys    *clientFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	listed  bool
+	closed  bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *fsDir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
@@ -0,0 +1,87 @@
+package goftp
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := fstest.TestFS(c.FS("subdir"), "1234.bin"); err != nil {
+			t.Fatal(err)
+		}
+
+		fsys := c.FS("")
+
+		got, err := fs.ReadFile(fsys, "lorem.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := ioutil.ReadFile("testroot/lorem.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != string(expected) {
+			t.Errorf("got %q", got)
+		}
+
+		info, err := fs.Stat(fsys, "subdir/1234.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name() != "1234.bin" || info.Size() != 4 || info.IsDir() {
+			t.Errorf("got %s %d %v", info.Name(), info.Size(), info.IsDir())
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fsys := c.FS("")
+
+		_, err = fsys.Open("does-not-exist")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got %v", err)
+		}
+
+		_, err = fs.ReadFile(fsys, "subdir/does-not-exist")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got %v", err)
+		}
+
+		_, err = fs.ReadDir(fsys, "does-not-exist")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got %v", err)
+		}
+
+		_, err = fsys.Open("../lorem.txt")
+		if !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("got %v", err)
+		}
+
+		var ftpErr Error
+		if _, err := fs.Stat(fsys, "does-not-exist"); !errors.As(err, &ftpErr) || ftpErr.Code() != 550 {
+			t.Errorf("got %v", err)
+		}
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/Infiziert90/goftp
 
-go 1.12
+go 1.16
@@ -0,0 +1,31 @@
+package goftptest_test
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Infiziert90/goftp"
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func ExampleNewServer() {
+	fs := goftptest.NewMemFS()
+	fs.WriteFile("/readme.txt", []byte("hello, world"), 0644)
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	client, err := goftp.Dial(server.Addr)
+	if err != nil {
+		panic(err)
+	}
+	defer client.Close()
+
+	buf := new(bytes.Buffer)
+	if err := client.Retrieve("readme.txt", buf); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(buf.String())
+	// Output: hello, world
+}
@@ -0,0 +1,518 @@
+package goftptest
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSystem is the tree of files a Server exposes. Names are always
+// slash-separated and absolute ("/", "/subdir/1234.bin"), already resolved
+// against the client's working directory. Errors should satisfy
+// os.IsNotExist, os.IsExist and os.IsPermission where appropriate so the
+// server can pick a fitting reply.
+type FileSystem interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Mkdir(name string, perm os.FileMode) error
+	Remove(name string) error
+	Rename(oldname, newname string) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Chmod(name string, mode os.FileMode) error
+}
+
+// SymlinkFS is implemented by FileSystems with symbolic links. Stat follows
+// links while Lstat doesn't, and ReadDir returns the links themselves. The
+// server lists links with their target, as "name -> target" in LIST and as
+// "type=OS.unix=slink:target" in MLST/MLSD.
+type SymlinkFS interface {
+	FileSystem
+	Lstat(name string) (os.FileInfo, error)
+	Readlink(name string) (string, error)
+}
+
+// File is an open file in a FileSystem.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// Dir is a FileSystem backed by the native file system, rooted at the named
+// directory.
+type Dir string
+
+func (d Dir) resolve(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// Stat implements FileSystem.
+func (d Dir) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(d.resolve(name))
+}
+
+// Lstat implements SymlinkFS.
+func (d Dir) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(d.resolve(name))
+}
+
+// Readlink implements SymlinkFS. Targets are returned verbatim, so absolute
+// ones refer to the native file system.
+func (d Dir) Readlink(name string) (string, error) {
+	return os.Readlink(d.resolve(name))
+}
+
+// ReadDir implements FileSystem.
+func (d Dir) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(d.resolve(name))
+}
+
+// OpenFile implements FileSystem.
+func (d Dir) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(d.resolve(name), flag, perm)
+}
+
+// Mkdir implements FileSystem.
+func (d Dir) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(d.resolve(name), perm)
+}
+
+// Remove implements FileSystem.
+func (d Dir) Remove(name string) error {
+	return os.Remove(d.resolve(name))
+}
+
+// Rename implements FileSystem.
+func (d Dir) Rename(oldname, newname string) error {
+	return os.Rename(d.resolve(oldname), d.resolve(newname))
+}
+
+// Chtimes implements FileSystem.
+func (d Dir) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(d.resolve(name), atime, mtime)
+}
+
+// Chmod implements FileSystem.
+func (d Dir) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(d.resolve(name), mode)
+}
+
+// MemFS is a FileSystem held entirely in memory. Create one with NewMemFS.
+type MemFS struct {
+	mu   sync.Mutex
+	root *memNode
+}
+
+type memNode struct {
+	mode     os.FileMode
+	mtime    time.Time
+	data     []byte
+	children map[string]*memNode
+}
+
+// NewMemFS returns an empty in-memory file system.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		root: &memNode{
+			mode:     os.ModeDir | 0755,
+			mtime:    time.Now(),
+			children: make(map[string]*memNode),
+		},
+	}
+}
+
+// WriteFile creates the file "name" with the given contents, creating any
+// missing parent directories.
+func (fs *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := fs.MkdirAll(path.Dir(path.Clean("/"+name)), 0755); err != nil {
+		return err
+	}
+
+	f, err := fs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// MkdirAll creates directory "name" along with any missing parents.
+func (fs *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node := fs.root
+	for _, part := range splitPath(name) {
+		child, ok := node.children[part]
+		if !ok {
+			child = &memNode{
+				mode:     os.ModeDir | perm.Perm(),
+				mtime:    time.Now(),
+				children: make(map[string]*memNode),
+			}
+			node.children[part] = child
+			node.mtime = child.mtime
+		} else if !child.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: errNotDir}
+		}
+		node = child
+	}
+	return nil
+}
+
+var (
+	errNotDir   = errors.New("not a directory")
+	errIsDir    = errors.New("is a directory")
+	errNotEmpty = errors.New("directory not empty")
+)
+
+func splitPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// lookup finds the node for name. Must be called with fs.mu held.
+func (fs *MemFS) lookup(op, name string) (*memNode, error) {
+	node := fs.root
+	for _, part := range splitPath(name) {
+		if node.children == nil {
+			return nil, &os.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+		child, ok := node.children[part]
+		if !ok {
+			return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// lookupParent finds the directory containing name, returning it along with
+// name's base name. Must be called with fs.mu held.
+func (fs *MemFS) lookupParent(op, name string) (*memNode, string, error) {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+	}
+
+	dir, err := fs.lookup(op, path.Join(parts[:len(parts)-1]...))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if dir.children == nil {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+
+	return dir, parts[len(parts)-1], nil
+}
+
+// Stat implements FileSystem.
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, err := fs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(path.Clean("/" + name))
+	return node.info(base), nil
+}
+
+// ReadDir implements FileSystem.
+func (fs *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, err := fs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.children == nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	var infos []os.FileInfo
+	for childName, child := range node.children {
+		infos = append(infos, child.info(childName))
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+// OpenFile implements FileSystem.
+func (fs *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dir, base, err := fs.lookupParent("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := dir.children[base]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		node = &memNode{
+			mode:  perm.Perm(),
+			mtime: time.Now(),
+		}
+		dir.children[base] = node
+		dir.mtime = node.mtime
+	} else if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	if node.mode.IsDir() && writable {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+	}
+
+	if writable && flag&os.O_TRUNC != 0 {
+		node.data = nil
+		node.mtime = time.Now()
+	}
+
+	return &memFile{
+		fs:       fs,
+		node:     node,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+// Mkdir implements FileSystem.
+func (fs *MemFS) Mkdir(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dir, base, err := fs.lookupParent("mkdir", name)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := dir.children[base]; ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+
+	dir.children[base] = &memNode{
+		mode:     os.ModeDir | perm.Perm(),
+		mtime:    time.Now(),
+		children: make(map[string]*memNode),
+	}
+	dir.mtime = time.Now()
+
+	return nil
+}
+
+// Remove implements FileSystem.
+func (fs *MemFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dir, base, err := fs.lookupParent("remove", name)
+	if err != nil {
+		return err
+	}
+
+	node, ok := dir.children[base]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+
+	if len(node.children) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+
+	delete(dir.children, base)
+	dir.mtime = time.Now()
+
+	return nil
+}
+
+// Rename implements FileSystem.
+func (fs *MemFS) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	oldDir, oldBase, err := fs.lookupParent("rename", oldname)
+	if err != nil {
+		return err
+	}
+
+	node, ok := oldDir.children[oldBase]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldname, Err: os.ErrNotExist}
+	}
+
+	newDir, newBase, err := fs.lookupParent("rename", newname)
+	if err != nil {
+		return err
+	}
+
+	if existing, ok := newDir.children[newBase]; ok && existing.mode.IsDir() {
+		return &os.PathError{Op: "rename", Path: newname, Err: os.ErrExist}
+	}
+
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = node
+	oldDir.mtime = time.Now()
+	newDir.mtime = oldDir.mtime
+
+	return nil
+}
+
+// Chtimes implements FileSystem. MemFS only keeps track of mtimes, so atime
+// is ignored.
+func (fs *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, err := fs.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+
+	node.mtime = mtime
+	return nil
+}
+
+// Chmod implements FileSystem.
+func (fs *MemFS) Chmod(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, err := fs.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+
+	const chmodBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	node.mode = node.mode&^chmodBits | mode&chmodBits
+	return nil
+}
+
+func (node *memNode) info(name string) os.FileInfo {
+	return &memFileInfo{
+		name:  name,
+		size:  int64(len(node.data)),
+		mode:  node.mode,
+		mtime: node.mtime,
+	}
+}
+
+type memFileInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	fs       *MemFS
+	node     *memNode
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if !f.readable || f.node.mode.IsDir() {
+		return 0, os.ErrPermission
+	}
+
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if !f.writable {
+		return 0, os.ErrPermission
+	}
+
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.node.mtime = time.Now()
+
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
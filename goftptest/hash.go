@@ -0,0 +1,108 @@
+package goftptest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// hash algorithms supported by HASH, in the order advertised by FEAT
+var hashNames = []string{"SHA-256", "SHA-1", "SHA-512", "MD5", "CRC32"}
+
+var hashes = map[string]func() hash.Hash{
+	"SHA-256": sha256.New,
+	"SHA-1":   sha1.New,
+	"SHA-512": sha512.New,
+	"MD5":     md5.New,
+	"CRC32":   func() hash.Hash { return crc32.NewIEEE() },
+}
+
+// hashFeature returns the HASH line for FEAT, marking the selected
+// algorithm with a "*".
+func (sess *session) hashFeature() string {
+	algos := make([]string, len(hashNames))
+	for i, name := range hashNames {
+		if name == sess.hashAlgo {
+			name += "*"
+		}
+		algos[i] = name
+	}
+	return "HASH " + strings.Join(algos, ";")
+}
+
+func (sess *session) optsHASH(arg string) {
+	arg = strings.ToUpper(strings.TrimSpace(arg))
+	if arg == "" {
+		sess.reply(200, "%s", sess.hashAlgo)
+		return
+	}
+
+	if _, ok := hashes[arg]; !ok {
+		sess.reply(501, "Unknown algorithm, current selection not changed.")
+		return
+	}
+
+	sess.hashAlgo = arg
+	sess.reply(200, "%s", arg)
+}
+
+// handleHASH implements HASH as described in draft-bryan-ftpext-hash.
+func (sess *session) handleHASH(arg string) {
+	digest, size, err := sess.fileHash(sess.path(arg), sess.hashAlgo)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(213, "%s 0-%d %s %s", sess.hashAlgo, size, digest, arg)
+}
+
+func (sess *session) handleXCRC(arg string)    { sess.xhash("CRC32", arg) }
+func (sess *session) handleXMD5(arg string)    { sess.xhash("MD5", arg) }
+func (sess *session) handleXSHA1(arg string)   { sess.xhash("SHA-1", arg) }
+func (sess *session) handleXSHA256(arg string) { sess.xhash("SHA-256", arg) }
+func (sess *session) handleXSHA512(arg string) { sess.xhash("SHA-512", arg) }
+
+// xhash implements the older single algorithm commands, which reply with
+// just the digest.
+func (sess *session) xhash(algo, arg string) {
+	digest, _, err := sess.fileHash(sess.path(arg), algo)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(250, "%s", strings.ToUpper(digest))
+}
+
+func (sess *session) fileHash(name, algo string) (string, int64, error) {
+	info, err := sess.fs().Stat(name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", 0, &os.PathError{Op: "hash", Path: name, Err: os.ErrInvalid}
+	}
+
+	f, err := sess.fs().OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := hashes[algo]()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,265 @@
+/*
+Package goftptest provides an in-process FTP server for tests.
+
+The server speaks enough of the protocol to exercise a full featured client
+(including goftp itself) hermetically: USER/PASS, FEAT, EPSV/PASV/PORT/EPRT,
+MLSD/MLST (and OPTS MLST), LIST/NLST, SIZE, REST STREAM, HASH (and XCRC/XMD5/
+XSHA1/XSHA256/XSHA512), MDTM/MFMT, SITE CHMOD and SITE UTIME, explicit
+("AUTH TLS") and implicit TLS, plus the usual file management commands. It
+serves any FileSystem, such as a directory on disk (Dir) or an in-memory tree
+(MemFS).
+*/
+package goftptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an FTP server listening on a loopback port.
+type Server struct {
+	// Addr is the host:port the server listens on. It is set by Start and
+	// StartTLS.
+	Addr string
+
+	// Listener accepts control connections. NewUnstartedServer listens on a
+	// random loopback port; replace it before starting to listen elsewhere.
+	Listener net.Listener
+
+	// FileSystem is the tree served to clients.
+	FileSystem FileSystem
+
+	// Users maps user names to passwords. If nil, any user name and password
+	// is accepted.
+	Users map[string]string
+
+	// TLS is the configuration used for "AUTH TLS" and implicit TLS. If nil,
+	// Start and StartTLS fill it in with a self-signed certificate for the
+	// loopback addresses.
+	TLS *tls.Config
+
+	// Disabled lists commands the server pretends not to implement (e.g.
+	// "EPSV" or "SITE UTIME"). Disabled commands are answered with 502 and
+	// left out of FEAT. Disabling "MLST" disables "MLSD" too.
+	Disabled []string
+
+	// System is the reply to SYST. It defaults to "UNIX Type: L8".
+	System string
+
+	// ListLine, if non-nil, formats each LIST entry instead of the default
+	// "ls -l" style, e.g. to mimic the DOS format of IIS.
+	ListLine func(info os.FileInfo) string
+
+	// Logger, if non-nil, receives a transcript of every control connection.
+	Logger io.Writer
+
+	implicitTLS bool
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+	nextID   int
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer starts and returns a server serving fs. The caller should call
+// Close when finished.
+func NewServer(fs FileSystem) *Server {
+	s := NewUnstartedServer(fs)
+	s.Start()
+	return s
+}
+
+// NewTLSServer starts and returns a server serving fs over implicit TLS. The
+// caller should call Close when finished.
+func NewTLSServer(fs FileSystem) *Server {
+	s := NewUnstartedServer(fs)
+	s.StartTLS()
+	return s
+}
+
+// NewUnstartedServer returns a server serving fs, but doesn't start it.
+// After changing its configuration, the caller should call Start or
+// StartTLS.
+func NewUnstartedServer(fs FileSystem) *Server {
+	return &Server{
+		Listener:   newLocalListener(),
+		FileSystem: fs,
+	}
+}
+
+func newLocalListener() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("goftptest: failed to listen on a port: %v", err))
+		}
+	}
+	return l
+}
+
+// Start starts the server.
+func (s *Server) Start() {
+	if s.Addr != "" {
+		panic("goftptest: server already started")
+	}
+
+	if s.TLS == nil {
+		config, err := generateTLSConfig()
+		if err != nil {
+			panic(fmt.Sprintf("goftptest: failed generating certificate: %v", err))
+		}
+		s.TLS = config
+	}
+
+	if s.implicitTLS {
+		s.Listener = tls.NewListener(s.Listener, s.TLS)
+	}
+
+	s.sessions = make(map[*session]struct{})
+	s.Addr = s.Listener.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// StartTLS starts the server using implicit TLS, i.e. clients must start
+// the TLS handshake as soon as they connect.
+func (s *Server) StartTLS() {
+	s.implicitTLS = true
+	s.Start()
+}
+
+// Close shuts down the server, interrupting any sessions in progress, and
+// waits for everything to wind down.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.Listener.Close()
+	for sess := range s.sessions {
+		sess.close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Certificate returns the certificate used for TLS connections, or nil if
+// the server hasn't been started yet.
+func (s *Server) Certificate() *x509.Certificate {
+	if s.TLS == nil || len(s.TLS.Certificates) == 0 {
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(s.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		panic(fmt.Sprintf("goftptest: failed parsing certificate: %v", err))
+	}
+	return cert
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if !closed {
+				s.logf("error accepting connection: %s", err)
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.nextID++
+		sess := newSession(s, s.nextID, conn)
+		s.sessions[sess] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			sess.serve()
+
+			s.mu.Lock()
+			delete(s.sessions, sess)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) disabled(cmd string) bool {
+	for _, d := range s.Disabled {
+		d = strings.ToUpper(d)
+		if d == cmd || (d == "MLST" && cmd == "MLSD") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) logf(f string, args ...interface{}) {
+	if s.Logger == nil {
+		return
+	}
+	fmt.Fprintf(s.Logger, "goftptest: %s\n", fmt.Sprintf(f, args...))
+}
+
+// generateTLSConfig creates a throwaway self-signed certificate valid for
+// the loopback addresses.
+func generateTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"goftptest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+	}, nil
+}
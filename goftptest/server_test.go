@@ -0,0 +1,255 @@
+package goftptest_test
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Infiziert90/goftp"
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func TestMemFS(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("/pub/hello.txt", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := goftp.Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	buf := new(bytes.Buffer)
+	if err := c.Retrieve("pub/hello.txt", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "hello" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	if _, err := c.Mkdir("pub/sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Store("pub/sub/world.txt", strings.NewReader("world")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Rename("pub/hello.txt", "pub/sub/hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := c.ReadDir("pub/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, ",") != "hello.txt,world.txt" {
+		t.Errorf("got %v", names)
+	}
+
+	if err := c.Delete("pub/sub/hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete("pub/sub/hello.txt"); err == nil {
+		t.Error("expected error deleting missing file")
+	}
+
+	if err := c.Rmdir("pub/sub"); err == nil {
+		t.Error("expected error removing non-empty directory")
+	}
+}
+
+func TestUsers(t *testing.T) {
+	server := goftptest.NewUnstartedServer(goftptest.NewMemFS())
+	server.Users = map[string]string{"goftp": "rocks"}
+	server.Start()
+	defer server.Close()
+
+	c, err := goftp.DialConfig(goftp.Config{User: "goftp", Password: "wrong"}, server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.ReadDir("")
+	if err == nil || err.(goftp.Error).Code() != 530 {
+		t.Errorf("expected 530, got %v", err)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	server := goftptest.NewUnstartedServer(goftptest.NewMemFS())
+	server.Disabled = []string{"EPSV", "MLST"}
+	server.Start()
+	defer server.Close()
+
+	c, err := goftp.Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rawConn, err := c.OpenRawConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawConn.Close()
+
+	_, msg, err := rawConn.SendCommand("FEAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(msg, "EPSV") || strings.Contains(msg, "MLST") {
+		t.Errorf("disabled commands advertised: %s", msg)
+	}
+
+	for _, cmd := range []string{"EPSV", "MLSD", "MLST"} {
+		code, _, err := rawConn.SendCommand(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != 502 {
+			t.Errorf("%s: got %d", cmd, code)
+		}
+	}
+
+	// client falls back to PASV and LIST
+	if err := c.Store("foo", strings.NewReader("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := c.ReadDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(infos) != 1 || infos[0].Name() != "foo" || infos[0].Size() != 3 {
+		t.Errorf("got %v", infos)
+	}
+}
+
+func TestABOR(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("big", make([]byte, 10*1024*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := goftp.Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rawConn, err := c.OpenRawConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawConn.Close()
+
+	// Telnet IP and Synch are ignored
+	code, _, err := rawConn.SendCommand("\xff\xf4\xff\xf2ABOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 225 {
+		t.Errorf("expected 225 without a transfer, got %d", code)
+	}
+
+	dcGetter, err := rawConn.PrepareDataConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, err := rawConn.SendCommand("RETR big"); err != nil || code != 150 {
+		t.Fatalf("RETR: %d %v", code, err)
+	}
+
+	dc, err := dcGetter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.Close()
+
+	if code, _, err := rawConn.ReadResponse(); err != nil || code != 426 {
+		t.Errorf("expected 426 for the interrupted transfer, got %d %v", code, err)
+	}
+
+	code, _, err = rawConn.SendCommand("\xff\xf4\xff\xf2ABOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 226 {
+		t.Errorf("expected 226 after an interrupted transfer, got %d", code)
+	}
+}
+
+func TestOPTSMLST(t *testing.T) {
+	fs := goftptest.NewMemFS()
+	if err := fs.WriteFile("lorem.txt", []byte("lorem"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := goftp.Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rawConn, err := c.OpenRawConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rawConn.Close()
+
+	code, msg, err := rawConn.SendCommand("OPTS MLST Type;size;bogus;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 200 || msg != "MLST OPTS type;size;" {
+		t.Errorf("got %d-%s", code, msg)
+	}
+
+	code, msg, err = rawConn.SendCommand("MLST lorem.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 250 || !strings.Contains(msg, " type=file;size=5; lorem.txt") {
+		t.Errorf("got %d-%s", code, msg)
+	}
+
+	code, msg, err = rawConn.SendCommand("FEAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != 211 || !strings.Contains(msg, " MLST type*;size*;modify;perm;UNIX.mode;unique;") {
+		t.Errorf("got %d-%s", code, msg)
+	}
+}
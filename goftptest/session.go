@@ -0,0 +1,1368 @@
+package goftptest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how long to wait for the client's end of a data connection
+const dataConnTimeout = 10 * time.Second
+
+// A session is a single control connection.
+type session struct {
+	server *Server
+	id     int
+
+	// guards conn and dataConn, which Server.Close closes from another
+	// goroutine
+	mu       sync.Mutex
+	conn     net.Conn
+	dataConn net.Conn
+
+	reader *textproto.Reader
+	writer *textproto.Writer
+
+	user     string
+	loggedIn bool
+	cwd      string
+
+	// control connection is using TLS
+	tls bool
+
+	// data connections must use TLS ("PROT P")
+	protected bool
+
+	// offset requested with REST for the next transfer
+	restOffset int64
+
+	// the last transfer was cut short, so ABOR has something to abort
+	transferAborted bool
+
+	// source of a pending RNFR/RNTO pair
+	renameFrom string
+
+	// algorithm used by HASH, selected with "OPTS HASH"
+	hashAlgo string
+
+	// facts included in MLST/MLSD entries, selected with "OPTS MLST"
+	mlstEnabled map[string]bool
+
+	// pending data connection, set up with PASV/EPSV or PORT/EPRT
+	passiveListener net.Listener
+	activeAddr      string
+}
+
+type command struct {
+	handle func(*session, string)
+
+	// can be used before logging in
+	noLogin bool
+
+	// uses the pending data connection
+	data bool
+}
+
+var commands = map[string]command{
+	"ABOR": {handle: (*session).handleABOR},
+	"ALLO": {handle: (*session).handleALLO},
+	"APPE": {handle: (*session).handleAPPE, data: true},
+	"AUTH": {handle: (*session).handleAUTH, noLogin: true},
+	"CDUP": {handle: (*session).handleCDUP},
+	"CLNT": {handle: (*session).handleCLNT, noLogin: true},
+	"CWD":  {handle: (*session).handleCWD},
+	"DELE": {handle: (*session).handleDELE},
+	"EPRT": {handle: (*session).handleEPRT},
+	"EPSV": {handle: (*session).handleEPSV},
+	"FEAT": {handle: (*session).handleFEAT, noLogin: true},
+	"HASH": {handle: (*session).handleHASH},
+	"LIST": {handle: (*session).handleLIST, data: true},
+	"MDTM": {handle: (*session).handleMDTM},
+	"MFMT": {handle: (*session).handleMFMT},
+	"MKD":  {handle: (*session).handleMKD},
+	"MLSD": {handle: (*session).handleMLSD, data: true},
+	"MLST": {handle: (*session).handleMLST},
+	"MODE": {handle: (*session).handleMODE},
+	"NLST": {handle: (*session).handleNLST, data: true},
+	"NOOP": {handle: (*session).handleNOOP, noLogin: true},
+	"OPTS": {handle: (*session).handleOPTS, noLogin: true},
+	"PASS": {handle: (*session).handlePASS, noLogin: true},
+	"PASV": {handle: (*session).handlePASV},
+	"PBSZ": {handle: (*session).handlePBSZ, noLogin: true},
+	"PORT": {handle: (*session).handlePORT},
+	"PROT": {handle: (*session).handlePROT, noLogin: true},
+	"PWD":  {handle: (*session).handlePWD},
+	"QUIT": {handle: (*session).handleQUIT, noLogin: true},
+	"REST": {handle: (*session).handleREST},
+	"RETR": {handle: (*session).handleRETR, data: true},
+	"RMD":  {handle: (*session).handleRMD},
+	"RNFR": {handle: (*session).handleRNFR},
+	"RNTO": {handle: (*session).handleRNTO},
+	"SITE": {handle: (*session).handleSITE},
+	"SIZE": {handle: (*session).handleSIZE},
+	"STOR": {handle: (*session).handleSTOR, data: true},
+	"STRU": {handle: (*session).handleSTRU},
+	"SYST": {handle: (*session).handleSYST, noLogin: true},
+	"TYPE": {handle: (*session).handleTYPE},
+	"USER": {handle: (*session).handleUSER, noLogin: true},
+	"XCRC": {handle: (*session).handleXCRC},
+	"XCWD": {handle: (*session).handleCWD},
+	"XMD5": {handle: (*session).handleXMD5},
+	"XMKD": {handle: (*session).handleMKD},
+	"XPWD": {handle: (*session).handlePWD},
+	"XRMD": {handle: (*session).handleRMD},
+
+	"XSHA1":   {handle: (*session).handleXSHA1},
+	"XSHA256": {handle: (*session).handleXSHA256},
+	"XSHA512": {handle: (*session).handleXSHA512},
+}
+
+// features advertised in response to FEAT, keyed by the command they
+// describe
+var features = []struct {
+	cmd  string
+	line string
+}{
+	{"AUTH", "AUTH TLS"},
+	{"EPRT", "EPRT"},
+	{"EPSV", "EPSV"},
+	{"HASH", ""}, // see hashFeature
+	{"MDTM", "MDTM"},
+	{"MFMT", "MFMT"},
+	{"MLST", ""}, // see mlstFeature
+	{"PASV", "PASV"},
+	{"PBSZ", "PBSZ"},
+	{"PROT", "PROT"},
+	{"REST", "REST STREAM"},
+	{"SIZE", "SIZE"},
+	{"TVFS", "TVFS"},
+	{"UTF8", "UTF8"},
+	{"XCRC", "XCRC"},
+	{"XMD5", "XMD5"},
+	{"XSHA1", "XSHA1"},
+	{"XSHA256", "XSHA256"},
+	{"XSHA512", "XSHA512"},
+}
+
+func newSession(server *Server, id int, conn net.Conn) *session {
+	sess := &session{
+		server:   server,
+		id:       id,
+		cwd:      "/",
+		hashAlgo: "SHA-256",
+	}
+	// implicit TLS protects data connections from the start
+	_, sess.tls = conn.(*tls.Conn)
+	sess.protected = sess.tls
+	sess.setConn(conn)
+	return sess
+}
+
+func (sess *session) setConn(conn net.Conn) {
+	sess.mu.Lock()
+	sess.conn = conn
+	sess.mu.Unlock()
+	sess.reader = textproto.NewReader(bufio.NewReader(conn))
+	sess.writer = textproto.NewWriter(bufio.NewWriter(conn))
+}
+
+func (sess *session) close() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.dataConn != nil {
+		sess.dataConn.Close()
+	}
+	sess.conn.Close()
+}
+
+func (sess *session) setDataConn(conn net.Conn) {
+	sess.mu.Lock()
+	sess.dataConn = conn
+	sess.mu.Unlock()
+}
+
+func (sess *session) serve() {
+	defer sess.close()
+	defer sess.resetDataConn()
+
+	sess.logf("connected from %s", sess.conn.RemoteAddr())
+	sess.reply(220, "goftptest ready")
+
+	for {
+		line, err := sess.reader.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				sess.logf("error reading command: %s", err)
+			}
+			return
+		}
+
+		line = stripTelnet(line)
+
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+		cmd = strings.ToUpper(cmd)
+
+		if cmd == "PASS" {
+			sess.logf("> PASS ******")
+		} else {
+			sess.logf("> %s", line)
+		}
+
+		c, ok := commands[cmd]
+		switch {
+		case !ok:
+			sess.reply(500, "'%s': command not understood.", line)
+		case sess.server.disabled(cmd):
+			sess.reply(502, "%s not implemented.", cmd)
+		case !c.noLogin && !sess.loggedIn:
+			sess.reply(530, "Please login with USER and PASS.")
+		case c.data && !sess.dataConnPending():
+			sess.reply(425, "Use PORT or PASV first.")
+		default:
+			c.handle(sess, arg)
+			if c.data {
+				sess.resetDataConn()
+			}
+		}
+
+		if cmd == "QUIT" {
+			return
+		}
+	}
+}
+
+func (sess *session) reply(code int, f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	sess.logf("< %d %s", code, msg)
+	if err := sess.writer.PrintfLine("%d %s", code, msg); err != nil {
+		sess.logf("error writing reply: %s", err)
+	}
+}
+
+// replyLines sends a multi-line reply. Lines are sent with a leading space
+// between the opening and closing line.
+func (sess *session) replyLines(code int, first string, lines []string, last string) {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "%d-%s\r\n", code, first)
+	for _, line := range lines {
+		fmt.Fprintf(buf, " %s\r\n", line)
+	}
+	fmt.Fprintf(buf, "%d %s\r\n", code, last)
+
+	sess.logf("< %s", strings.TrimSpace(buf.String()))
+
+	if _, err := sess.writer.W.WriteString(buf.String()); err != nil {
+		sess.logf("error writing reply: %s", err)
+		return
+	}
+	if err := sess.writer.W.Flush(); err != nil {
+		sess.logf("error writing reply: %s", err)
+	}
+}
+
+// replyError maps a FileSystem error onto a reply.
+func (sess *session) replyError(code int, err error) {
+	switch {
+	case os.IsNotExist(err):
+		sess.reply(code, "No such file or directory.")
+	case os.IsExist(err):
+		sess.reply(code, "File exists.")
+	case os.IsPermission(err):
+		sess.reply(code, "Permission denied.")
+	default:
+		sess.reply(code, "%s.", err)
+	}
+}
+
+func (sess *session) logf(f string, args ...interface{}) {
+	sess.server.logf("#%d %s", sess.id, fmt.Sprintf(f, args...))
+}
+
+// path resolves a path sent by the client against the working directory.
+func (sess *session) path(name string) string {
+	if name == "" {
+		return sess.cwd
+	}
+	if strings.HasPrefix(name, "/") {
+		return path.Clean(name)
+	}
+	return path.Join(sess.cwd, name)
+}
+
+func (sess *session) fs() FileSystem {
+	return sess.server.FileSystem
+}
+
+func (sess *session) handleUSER(arg string) {
+	sess.user = arg
+	sess.loggedIn = false
+	sess.reply(331, "User %s OK. Password required.", arg)
+}
+
+func (sess *session) handlePASS(arg string) {
+	if sess.user == "" {
+		sess.reply(503, "Login with USER first.")
+		return
+	}
+
+	if users := sess.server.Users; users != nil {
+		if password, ok := users[sess.user]; !ok || password != arg {
+			sess.reply(530, "Login incorrect.")
+			return
+		}
+	}
+
+	sess.loggedIn = true
+	sess.reply(230, "User %s logged in.", sess.user)
+}
+
+func (sess *session) handleQUIT(arg string) {
+	sess.reply(221, "Goodbye.")
+}
+
+func (sess *session) handleNOOP(arg string) {
+	sess.reply(200, "NOOP ok.")
+}
+
+func (sess *session) handleSYST(arg string) {
+	system := sess.server.System
+	if system == "" {
+		system = "UNIX Type: L8"
+	}
+	sess.reply(215, system)
+}
+
+func (sess *session) handleCLNT(arg string) {
+	sess.reply(200, "Noted.")
+}
+
+func (sess *session) handleALLO(arg string) {
+	sess.reply(202, "No storage allocation necessary.")
+}
+
+// handleABOR answers ABOR after the transfer it was meant for has already
+// replied 426, since commands are handled one at a time. Closing the data
+// connection is what actually interrupts a transfer.
+func (sess *session) handleABOR(arg string) {
+	if sess.transferAborted {
+		sess.transferAborted = false
+		sess.reply(226, "Abort successful.")
+		return
+	}
+
+	sess.reply(225, "No transfer to abort.")
+}
+
+// stripTelnet removes Telnet commands such as the IP and Synch sent ahead
+// of ABOR from a command line, unescaping doubled IAC bytes.
+func stripTelnet(line string) string {
+	const iac = 0xff
+
+	if strings.IndexByte(line, iac) < 0 {
+		return line
+	}
+
+	buf := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		if line[i] != iac {
+			buf = append(buf, line[i])
+			continue
+		}
+
+		i++
+		switch {
+		case i >= len(line):
+		case line[i] == iac:
+			buf = append(buf, iac)
+		case line[i] >= 251 && line[i] <= 254:
+			// WILL, WONT, DO and DONT take an option
+			i++
+		}
+	}
+
+	return string(buf)
+}
+
+func (sess *session) handleFEAT(arg string) {
+	var lines []string
+	for _, feat := range features {
+		if sess.server.disabled(feat.cmd) {
+			continue
+		}
+		if feat.cmd == "HASH" {
+			lines = append(lines, sess.hashFeature())
+		} else if feat.cmd == "MLST" {
+			lines = append(lines, sess.mlstFeature())
+		} else {
+			lines = append(lines, feat.line)
+		}
+	}
+	sess.replyLines(211, "Extensions supported:", lines, "End.")
+}
+
+func (sess *session) handleOPTS(arg string) {
+	if strings.ToUpper(arg) == "UTF8 ON" {
+		sess.reply(200, "OK, UTF-8 enabled.")
+		return
+	}
+
+	if opt := strings.ToUpper(arg); opt == "HASH" || strings.HasPrefix(opt, "HASH ") {
+		sess.optsHASH(arg[len("HASH"):])
+		return
+	}
+
+	if opt := strings.ToUpper(arg); opt == "MLST" || strings.HasPrefix(opt, "MLST ") {
+		sess.optsMLST(arg[len("MLST"):])
+		return
+	}
+	sess.reply(501, "Unknown option.")
+}
+
+func (sess *session) handleTYPE(arg string) {
+	switch strings.ToUpper(arg) {
+	case "A", "A N", "I", "L 8":
+		sess.reply(200, "Type set to %s.", arg)
+	default:
+		sess.reply(504, "Type %s not supported.", arg)
+	}
+}
+
+func (sess *session) handleMODE(arg string) {
+	if strings.ToUpper(arg) != "S" {
+		sess.reply(504, "Mode %s not supported.", arg)
+		return
+	}
+	sess.reply(200, "Mode set to S.")
+}
+
+func (sess *session) handleSTRU(arg string) {
+	if strings.ToUpper(arg) != "F" {
+		sess.reply(504, "Structure %s not supported.", arg)
+		return
+	}
+	sess.reply(200, "Structure set to F.")
+}
+
+func (sess *session) handleAUTH(arg string) {
+	switch strings.ToUpper(arg) {
+	case "TLS", "TLS-C", "SSL":
+	default:
+		sess.reply(504, "AUTH %s not supported.", arg)
+		return
+	}
+
+	if sess.tls {
+		sess.reply(503, "Already using TLS.")
+		return
+	}
+
+	sess.reply(234, "AUTH %s successful.", arg)
+	sess.setConn(tls.Server(sess.conn, sess.server.TLS))
+	sess.tls = true
+}
+
+func (sess *session) handlePBSZ(arg string) {
+	if !sess.tls {
+		sess.reply(503, "PBSZ requires TLS.")
+		return
+	}
+	sess.reply(200, "PBSZ=0")
+}
+
+func (sess *session) handlePROT(arg string) {
+	switch strings.ToUpper(arg) {
+	case "C":
+		sess.protected = false
+	case "P":
+		if !sess.tls {
+			sess.reply(503, "PROT P requires TLS.")
+			return
+		}
+		sess.protected = true
+	default:
+		sess.reply(504, "PROT %s not supported.", arg)
+		return
+	}
+	sess.reply(200, "Protection level set to %s.", strings.ToUpper(arg))
+}
+
+func (sess *session) handlePWD(arg string) {
+	sess.reply(257, `"%s" is the current directory.`, quote(sess.cwd))
+}
+
+func (sess *session) handleCWD(arg string) {
+	name := sess.path(arg)
+
+	info, err := sess.fs().Stat(name)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	if !info.IsDir() {
+		sess.reply(550, "Not a directory.")
+		return
+	}
+
+	sess.cwd = name
+	sess.reply(250, "Directory successfully changed.")
+}
+
+func (sess *session) handleCDUP(arg string) {
+	sess.handleCWD("..")
+}
+
+func (sess *session) handleMKD(arg string) {
+	name := sess.path(arg)
+
+	if err := sess.fs().Mkdir(name, 0777); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(257, `"%s" created.`, quote(name))
+}
+
+func (sess *session) handleRMD(arg string) {
+	name := sess.path(arg)
+
+	info, err := sess.fs().Stat(name)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	if !info.IsDir() {
+		sess.reply(550, "Not a directory.")
+		return
+	}
+
+	if err := sess.fs().Remove(name); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(250, "Directory removed.")
+}
+
+func (sess *session) handleDELE(arg string) {
+	name := sess.path(arg)
+
+	info, err := sess.fs().Stat(name)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	if info.IsDir() {
+		sess.reply(550, "Is a directory.")
+		return
+	}
+
+	if err := sess.fs().Remove(name); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(250, "File deleted.")
+}
+
+func (sess *session) handleRNFR(arg string) {
+	name := sess.path(arg)
+
+	if _, err := sess.fs().Stat(name); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.renameFrom = name
+	sess.reply(350, "Ready for RNTO.")
+}
+
+func (sess *session) handleRNTO(arg string) {
+	from := sess.renameFrom
+	sess.renameFrom = ""
+
+	if from == "" {
+		sess.reply(503, "Use RNFR first.")
+		return
+	}
+
+	if err := sess.fs().Rename(from, sess.path(arg)); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(250, "File renamed.")
+}
+
+// mdtmFormat is the time format of MDTM and MFMT.
+const mdtmFormat = "20060102150405"
+
+// parseTimeArg splits "YYYYMMDDHHMMSS[.sss] name" as used by MFMT and its
+// relatives.
+func parseTimeArg(arg string) (time.Time, string, bool) {
+	i := strings.IndexByte(arg, ' ')
+	if i < 0 || i == len(arg)-1 {
+		return time.Time{}, "", false
+	}
+
+	ts := arg[:i]
+	if dot := strings.IndexByte(ts, '.'); dot >= 0 {
+		ts = ts[:dot]
+	}
+
+	t, err := time.ParseInLocation(mdtmFormat, ts, time.UTC)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+
+	return t, arg[i+1:], true
+}
+
+func (sess *session) handleMDTM(arg string) {
+	// some servers let "MDTM YYYYMMDDHHMMSS name" set the time
+	if t, name, ok := parseTimeArg(arg); ok {
+		if _, err := sess.fs().Stat(sess.path(arg)); os.IsNotExist(err) {
+			if err := sess.fs().Chtimes(sess.path(name), t, t); err != nil {
+				sess.replyError(550, err)
+				return
+			}
+			sess.reply(213, "Modify=%s; %s", t.Format(mdtmFormat), name)
+			return
+		}
+	}
+
+	info, err := sess.fs().Stat(sess.path(arg))
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(213, "%s", info.ModTime().UTC().Format(mdtmFormat))
+}
+
+func (sess *session) handleMFMT(arg string) {
+	t, name, ok := parseTimeArg(arg)
+	if !ok {
+		sess.reply(501, "Usage: MFMT YYYYMMDDHHMMSS path.")
+		return
+	}
+
+	if err := sess.fs().Chtimes(sess.path(name), t, t); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(213, "Modify=%s; %s", t.Format(mdtmFormat), name)
+}
+
+// handleSITE dispatches SITE subcommands. Subcommands can be disabled
+// individually, e.g. "SITE UTIME".
+func (sess *session) handleSITE(arg string) {
+	sub, rest := arg, ""
+	if i := strings.IndexByte(arg, ' '); i >= 0 {
+		sub, rest = arg[:i], arg[i+1:]
+	}
+	sub = strings.ToUpper(sub)
+
+	if sess.server.disabled("SITE " + sub) {
+		sess.reply(502, "SITE %s not implemented.", sub)
+		return
+	}
+
+	switch sub {
+	case "CHMOD":
+		sess.siteCHMOD(rest)
+	case "UTIME":
+		sess.siteUTIME(rest)
+	default:
+		sess.reply(500, "SITE %s not understood.", sub)
+	}
+}
+
+// siteCHMOD implements "SITE CHMOD mode path", mode being octal.
+func (sess *session) siteCHMOD(arg string) {
+	i := strings.IndexByte(arg, ' ')
+	if i < 0 || i == len(arg)-1 {
+		sess.reply(501, "Usage: SITE CHMOD mode path.")
+		return
+	}
+
+	bits, err := strconv.ParseUint(arg[:i], 8, 32)
+	if err != nil || bits > 07777 {
+		sess.reply(501, "Invalid mode %s.", arg[:i])
+		return
+	}
+
+	if err := sess.fs().Chmod(sess.path(arg[i+1:]), fileMode(uint32(bits))); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(200, "SITE CHMOD command successful.")
+}
+
+// siteUTIME implements "SITE UTIME YYYYMMDDHHMMSS path".
+func (sess *session) siteUTIME(arg string) {
+	t, name, ok := parseTimeArg(arg)
+	if !ok {
+		sess.reply(501, "Usage: SITE UTIME YYYYMMDDHHMMSS path.")
+		return
+	}
+
+	if err := sess.fs().Chtimes(sess.path(name), t, t); err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.reply(200, "Date/time changed okay.")
+}
+
+func (sess *session) handleSIZE(arg string) {
+	info, err := sess.fs().Stat(sess.path(arg))
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		sess.reply(550, "Not a regular file.")
+		return
+	}
+
+	sess.reply(213, "%d", info.Size())
+}
+
+func (sess *session) handleREST(arg string) {
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 {
+		sess.reply(501, "Invalid offset.")
+		return
+	}
+
+	sess.restOffset = offset
+	sess.reply(350, "Restarting at %d. Send STOR or RETR.", offset)
+}
+
+// takeRestOffset returns the offset from a preceding REST command, which
+// only applies to the very next transfer.
+func (sess *session) takeRestOffset() int64 {
+	offset := sess.restOffset
+	sess.restOffset = 0
+	return offset
+}
+
+func (sess *session) handleRETR(arg string) {
+	offset := sess.takeRestOffset()
+	name := sess.path(arg)
+
+	info, err := sess.fs().Stat(name)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		sess.reply(550, "Not a regular file.")
+		return
+	}
+
+	f, err := sess.fs().OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+	defer f.Close()
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			sess.replyError(550, err)
+			return
+		}
+	}
+
+	sess.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(conn, f)
+		return err
+	})
+}
+
+func (sess *session) handleSTOR(arg string) {
+	offset := sess.takeRestOffset()
+
+	flag := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	sess.store(sess.path(arg), flag, offset)
+}
+
+func (sess *session) handleAPPE(arg string) {
+	sess.takeRestOffset()
+	sess.store(sess.path(arg), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0)
+}
+
+func (sess *session) store(name string, flag int, offset int64) {
+	f, err := sess.fs().OpenFile(name, flag, 0666)
+	if err != nil {
+		sess.replyError(553, err)
+		return
+	}
+
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			sess.replyError(553, err)
+			return
+		}
+	}
+
+	sess.transfer(func(conn net.Conn) error {
+		_, err := io.Copy(f, conn)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+}
+
+// listArgs strips "ls" style flags (e.g. "-la") from a listing command's
+// argument.
+func listArgs(arg string) string {
+	for strings.HasPrefix(arg, "-") {
+		i := strings.IndexByte(arg, ' ')
+		if i < 0 {
+			return ""
+		}
+		arg = strings.TrimLeft(arg[i+1:], " ")
+	}
+	return arg
+}
+
+// listing stats "name", returning the directory's contents or the file
+// itself.
+// listing returns the entries of the directory name, or just name itself if
+// it is a file. Like "ls -l", symbolic links named directly are listed
+// rather than followed, unless follow is set.
+func (sess *session) listing(name string, follow bool) ([]os.FileInfo, os.FileInfo, error) {
+	stat := sess.lstat
+	if follow {
+		stat = sess.fs().Stat
+	}
+
+	info, err := stat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !info.IsDir() {
+		info = sess.withLink(name, info)
+		return []os.FileInfo{info}, info, nil
+	}
+
+	infos, err := sess.fs().ReadDir(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	for i, entry := range infos {
+		infos[i] = sess.withLink(path.Join(name, entry.Name()), entry)
+	}
+
+	return infos, info, nil
+}
+
+// linkInfo is a symbolic link along with its target.
+type linkInfo struct {
+	os.FileInfo
+	target string
+}
+
+func (sess *session) lstat(name string) (os.FileInfo, error) {
+	if fsys, ok := sess.fs().(SymlinkFS); ok {
+		return fsys.Lstat(name)
+	}
+	return sess.fs().Stat(name)
+}
+
+// withLink adds the target to info if it is a symbolic link.
+func (sess *session) withLink(name string, info os.FileInfo) os.FileInfo {
+	fsys, ok := sess.fs().(SymlinkFS)
+	if !ok || info.Mode()&os.ModeSymlink == 0 {
+		return info
+	}
+
+	target, err := fsys.Readlink(name)
+	if err != nil {
+		return info
+	}
+
+	return linkInfo{info, target}
+}
+
+func (sess *session) handleLIST(arg string) {
+	infos, _, err := sess.listing(sess.path(listArgs(arg)), false)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	format := listLine
+	if sess.server.ListLine != nil {
+		format = sess.server.ListLine
+	}
+
+	sess.sendLines(infos, format)
+}
+
+func (sess *session) handleNLST(arg string) {
+	infos, _, err := sess.listing(sess.path(listArgs(arg)), false)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	sess.sendLines(infos, func(info os.FileInfo) string {
+		return info.Name()
+	})
+}
+
+func (sess *session) handleMLSD(arg string) {
+	name := sess.path(arg)
+
+	infos, dir, err := sess.listing(name, true)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+
+	if !dir.IsDir() {
+		sess.reply(501, "Not a directory.")
+		return
+	}
+
+	lines := []string{sess.mlstFacts(name, dir, "cdir") + " ."}
+	if name != "/" {
+		if parent, err := sess.fs().Stat(path.Dir(name)); err == nil {
+			lines = append(lines, sess.mlstFacts(path.Dir(name), parent, "pdir")+" ..")
+		}
+	}
+
+	for _, info := range infos {
+		lines = append(lines, sess.mlstFacts(path.Join(name, info.Name()), info, "")+" "+info.Name())
+	}
+
+	sess.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, line := range lines {
+			if _, err := w.WriteString(line + "\r\n"); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+}
+
+func (sess *session) handleMLST(arg string) {
+	p := sess.path(arg)
+	info, err := sess.lstat(p)
+	if err != nil {
+		sess.replyError(550, err)
+		return
+	}
+	info = sess.withLink(p, info)
+
+	name, typ := arg, ""
+	if arg == "" || arg == "." {
+		name, typ = ".", "cdir"
+	}
+
+	sess.replyLines(250, "Listing "+name, []string{sess.mlstFacts(p, info, typ) + " " + name}, "End.")
+}
+
+func (sess *session) sendLines(infos []os.FileInfo, format func(os.FileInfo) string) {
+	sess.transfer(func(conn net.Conn) error {
+		w := bufio.NewWriter(conn)
+		for _, info := range infos {
+			if _, err := w.WriteString(format(info) + "\r\n"); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	})
+}
+
+// listLine formats info like "ls -l".
+func listLine(info os.FileInfo) string {
+	mtime := info.ModTime().UTC()
+
+	var when string
+	if sixMonths := 182 * 24 * time.Hour; time.Since(mtime) < sixMonths && time.Until(mtime) < sixMonths {
+		when = mtime.Format("Jan _2 15:04")
+	} else {
+		when = mtime.Format("Jan _2  2006")
+	}
+
+	name := info.Name()
+	if link, ok := info.(linkInfo); ok {
+		name += " -> " + link.target
+	}
+
+	return fmt.Sprintf("%s 1 ftp      ftp      %12d %s %s", lsMode(info.Mode()), info.Size(), when, name)
+}
+
+// lsMode formats mode like the first column of "ls -l".
+func lsMode(mode os.FileMode) string {
+	buf := []byte("----------")
+
+	switch {
+	case mode.IsDir():
+		buf[0] = 'd'
+	case mode&os.ModeSymlink != 0:
+		buf[0] = 'l'
+	}
+
+	const rwx = "rwxrwxrwx"
+	for i := 0; i < 9; i++ {
+		if mode&(1<<uint(8-i)) != 0 {
+			buf[i+1] = rwx[i]
+		}
+	}
+
+	// setuid, setgid and sticky replace the execute bits, upper case if
+	// the execute bit isn't set
+	special := func(i int, set bool, c byte) {
+		if !set {
+			return
+		}
+		if buf[i] == '-' {
+			c -= 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	special(3, mode&os.ModeSetuid != 0, 's')
+	special(6, mode&os.ModeSetgid != 0, 's')
+	special(9, mode&os.ModeSticky != 0, 't')
+
+	return string(buf)
+}
+
+// unixMode converts mode's permission bits to the octal form used by chmod.
+func unixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// fileMode is the inverse of unixMode.
+func fileMode(bits uint32) os.FileMode {
+	mode := os.FileMode(bits).Perm()
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// MLST facts the server knows, in FEAT order. All but "unique" are enabled
+// until the client selects others with "OPTS MLST".
+var mlstFactNames = []string{"type", "size", "modify", "perm", "UNIX.mode", "unique"}
+
+func (sess *session) mlstFactEnabled(name string) bool {
+	if sess.mlstEnabled == nil {
+		return name != "unique"
+	}
+	return sess.mlstEnabled[name]
+}
+
+func (sess *session) mlstFeature() string {
+	var facts string
+	for _, name := range mlstFactNames {
+		facts += name
+		if sess.mlstFactEnabled(name) {
+			facts += "*"
+		}
+		facts += ";"
+	}
+	return "MLST " + facts
+}
+
+// optsMLST selects the facts to include in MLST/MLSD entries, ignoring
+// unknown ones (RFC 3659 section 7.9).
+func (sess *session) optsMLST(arg string) {
+	enabled := make(map[string]bool)
+	var selected string
+	for _, fact := range strings.Split(strings.TrimSpace(arg), ";") {
+		for _, name := range mlstFactNames {
+			if strings.EqualFold(fact, name) && !enabled[name] {
+				enabled[name] = true
+				selected += name + ";"
+			}
+		}
+	}
+
+	sess.mlstEnabled = enabled
+	sess.reply(200, "MLST OPTS %s", selected)
+}
+
+// mlstFacts formats the enabled RFC 3659 facts for info, found at the
+// absolute path name. If typ is empty, it is derived from info. The
+// "unique" fact is derived from name, so it doesn't survive renames.
+func (sess *session) mlstFacts(name string, info os.FileInfo, typ string) string {
+	mode := info.Mode()
+
+	if typ == "" {
+		typ = "file"
+		if mode.IsDir() {
+			typ = "dir"
+		} else if link, ok := info.(linkInfo); ok {
+			typ = "OS.unix=slink:" + link.target
+		}
+	}
+
+	var perm string
+	if mode.IsDir() {
+		perm = "el"
+		if mode&0200 != 0 {
+			perm += "cdfmp"
+		}
+	} else {
+		perm = "r"
+		if mode&0200 != 0 {
+			perm += "adfw"
+		}
+	}
+
+	values := map[string]string{
+		"type":      typ,
+		"modify":    info.ModTime().UTC().Format("20060102150405"),
+		"perm":      perm,
+		"UNIX.mode": fmt.Sprintf("%04o", unixMode(mode)),
+		"unique":    fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(name))),
+	}
+	if !mode.IsDir() {
+		values["size"] = strconv.FormatInt(info.Size(), 10)
+	}
+
+	var facts string
+	for _, name := range mlstFactNames {
+		if value, ok := values[name]; ok && sess.mlstFactEnabled(name) {
+			facts += name + "=" + value + ";"
+		}
+	}
+	return facts
+}
+
+// quote escapes double quotes in a pathname for 257 replies.
+func quote(name string) string {
+	return strings.Replace(name, `"`, `""`, -1)
+}
+
+func (sess *session) dataConnPending() bool {
+	return sess.passiveListener != nil || sess.activeAddr != ""
+}
+
+// resetDataConn forgets about any pending data connection.
+func (sess *session) resetDataConn() {
+	if sess.passiveListener != nil {
+		sess.passiveListener.Close()
+		sess.passiveListener = nil
+	}
+	sess.activeAddr = ""
+}
+
+func (sess *session) listenPassive() (int, error) {
+	sess.resetDataConn()
+
+	host, _, err := net.SplitHostPort(sess.conn.LocalAddr().String())
+	if err != nil {
+		return 0, err
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+
+	sess.passiveListener = l
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func (sess *session) handleEPSV(arg string) {
+	port, err := sess.listenPassive()
+	if err != nil {
+		sess.reply(425, "Can't open passive connection: %s.", err)
+		return
+	}
+
+	sess.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+}
+
+func (sess *session) handlePASV(arg string) {
+	host, _, _ := net.SplitHostPort(sess.conn.LocalAddr().String())
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		sess.reply(425, "PASV requires IPv4, use EPSV.")
+		return
+	}
+
+	port, err := sess.listenPassive()
+	if err != nil {
+		sess.reply(425, "Can't open passive connection: %s.", err)
+		return
+	}
+
+	sess.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d).",
+		ip[0], ip[1], ip[2], ip[3], port>>8, port&0xFF)
+}
+
+func (sess *session) handlePORT(arg string) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		sess.reply(501, "Invalid PORT argument.")
+		return
+	}
+
+	var nums [6]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || n > 255 {
+			sess.reply(501, "Invalid PORT argument.")
+			return
+		}
+		nums[i] = n
+	}
+
+	sess.resetDataConn()
+	sess.activeAddr = net.JoinHostPort(
+		fmt.Sprintf("%d.%d.%d.%d", nums[0], nums[1], nums[2], nums[3]),
+		strconv.Itoa(nums[4]<<8|nums[5]),
+	)
+	sess.reply(200, "PORT command successful.")
+}
+
+func (sess *session) handleEPRT(arg string) {
+	// |1|132.235.1.2|6275| or |2|1080::8:800:200C:417A|5282|
+	if len(arg) < 2 {
+		sess.reply(501, "Invalid EPRT argument.")
+		return
+	}
+
+	parts := strings.Split(arg, arg[:1])
+	if len(parts) != 5 || net.ParseIP(parts[2]) == nil {
+		sess.reply(501, "Invalid EPRT argument.")
+		return
+	}
+
+	if _, err := strconv.Atoi(parts[3]); err != nil {
+		sess.reply(501, "Invalid EPRT argument.")
+		return
+	}
+
+	sess.resetDataConn()
+	sess.activeAddr = net.JoinHostPort(parts[2], parts[3])
+	sess.reply(200, "EPRT command successful.")
+}
+
+// transfer sends the preliminary reply, connects the pending data
+// connection, hands it to fn, and sends the final reply.
+func (sess *session) transfer(fn func(net.Conn) error) {
+	sess.reply(150, "Opening data connection.")
+
+	conn, err := sess.openDataConn()
+	if err != nil {
+		sess.reply(425, "Can't open data connection: %s.", err)
+		return
+	}
+
+	sess.setDataConn(conn)
+	err = fn(conn)
+	conn.Close()
+	sess.setDataConn(nil)
+
+	sess.transferAborted = err != nil
+
+	if err != nil {
+		sess.logf("transfer failed: %s", err)
+		sess.reply(426, "Connection closed; transfer aborted.")
+		return
+	}
+
+	sess.reply(226, "Transfer complete.")
+}
+
+func (sess *session) openDataConn() (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if l := sess.passiveListener; l != nil {
+		sess.passiveListener = nil
+		defer l.Close()
+
+		if tl, ok := l.(*net.TCPListener); ok {
+			tl.SetDeadline(time.Now().Add(dataConnTimeout))
+		}
+
+		conn, err = l.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if sess.protected {
+			conn = tls.Server(conn, sess.server.TLS)
+		}
+	} else if sess.activeAddr != "" {
+		addr := sess.activeAddr
+		sess.activeAddr = ""
+
+		conn, err = net.DialTimeout("tcp", addr, dataConnTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if sess.protected {
+			// the client plays the TLS server for active connections
+			conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		}
+	} else {
+		return nil, errors.New("no data connection")
+	}
+
+	return conn, nil
+}
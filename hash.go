@@ -0,0 +1,277 @@
+package goftp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// Hash algorithms for Hash and WithVerifyHash, named as in the HASH command.
+const (
+	HashCRC32  = "CRC32"
+	HashMD5    = "MD5"
+	HashSHA1   = "SHA-1"
+	HashSHA256 = "SHA-256"
+	HashSHA512 = "SHA-512"
+)
+
+var hashAlgorithms = map[string]struct {
+	// older single-algorithm command computing this hash
+	command string
+
+	// length of the hex encoded digest
+	hexLen int
+
+	new func() hash.Hash
+}{
+	HashCRC32:  {"XCRC", 8, func() hash.Hash { return crc32.NewIEEE() }},
+	HashMD5:    {"XMD5", 32, md5.New},
+	HashSHA1:   {"XSHA1", 40, sha1.New},
+	HashSHA256: {"XSHA256", 64, sha256.New},
+	HashSHA512: {"XSHA512", 128, sha512.New},
+}
+
+// Hash asks the server for the hex encoded digest of file "path" using
+// algorithm "algo" (e.g. HashSHA256). It prefers the HASH command
+// (draft-bryan-ftpext-hash), selecting the algorithm with "OPTS HASH", and
+// falls back to the XCRC, XMD5, XSHA1, XSHA256 and XSHA512 commands
+// depending on which ones the server lists in its FEAT response.
+func (c *Client) Hash(path, algo string) (string, error) {
+	return c.HashContext(context.Background(), path, algo)
+}
+
+// HashContext is like Hash, but gives up as soon as ctx is done.
+func (c *Client) HashContext(ctx context.Context, path, algo string) (string, error) {
+	digest, err := c.serverHash(ctx, path, algo)
+	if err != nil {
+		return "", err
+	}
+
+	if digest == "" {
+		return "", ftpError{err: fmt.Errorf("server doesn't support %s hashes", algo)}
+	}
+
+	return digest, nil
+}
+
+// serverHash is like Hash, but returns an empty digest if the server
+// can't compute the hash.
+func (c *Client) serverHash(ctx context.Context, path, algo string) (string, error) {
+	algo = strings.ToUpper(algo)
+
+	info, ok := hashAlgorithms[algo]
+	if !ok {
+		return "", ftpError{err: fmt.Errorf("unknown hash algorithm %s", algo)}
+	}
+
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer c.returnConn(pconn)
+
+	if pconn.hashAlgorithms()[algo] {
+		if err := pconn.selectHash(algo); err != nil {
+			return "", err
+		}
+
+		code, msg, err := pconn.sendCommand("HASH %s", path)
+		if err != nil {
+			return "", err
+		}
+
+		if code != replyFileStatus {
+			return "", ftpError{code: code, msg: msg}
+		}
+
+		// "SHA-256 0-49 169cd22282da7f147cb491e559e9dd filename"
+		fields := strings.Fields(msg)
+		if len(fields) < 3 || !strings.EqualFold(fields[0], algo) {
+			return "", ftpError{err: fmt.Errorf("unexpected HASH response: %s", msg)}
+		}
+
+		return normalizeDigest(fields[2], info.hexLen), nil
+	}
+
+	if pconn.hasFeature(info.command) {
+		code, msg, err := pconn.sendCommand("%s %s", info.command, path)
+		if err != nil {
+			return "", err
+		}
+
+		if !positiveCompletionReply(code) {
+			return "", ftpError{code: code, msg: msg}
+		}
+
+		// some servers echo the file name or other details along with the
+		// digest
+		for _, field := range strings.Fields(msg) {
+			if !isHex(field) {
+				continue
+			}
+			if len(field) == info.hexLen || algo == HashCRC32 && len(field) < info.hexLen {
+				return normalizeDigest(field, info.hexLen), nil
+			}
+		}
+
+		return "", ftpError{err: fmt.Errorf("unexpected %s response: %s", info.command, msg)}
+	}
+
+	pconn.debug("server can't compute %s hashes", algo)
+	return "", nil
+}
+
+// hashAlgorithms returns the algorithms supported by the HASH command, and
+// notes which one the server selected to start with.
+func (pconn *persistentConn) hashAlgorithms() map[string]bool {
+	algos := make(map[string]bool)
+
+	if !pconn.hasFeature("HASH") {
+		return algos
+	}
+
+	// "SHA-256*;SHA-1;MD5", the selected algorithm is marked with "*"
+	for _, algo := range strings.Split(pconn.features["HASH"], ";") {
+		algo = strings.ToUpper(strings.TrimSpace(algo))
+		if strings.HasSuffix(algo, "*") {
+			algo = strings.TrimSuffix(algo, "*")
+			if pconn.hashAlgo == "" {
+				pconn.hashAlgo = algo
+			}
+		}
+		if algo != "" {
+			algos[algo] = true
+		}
+	}
+
+	return algos
+}
+
+// selectHash makes algo the algorithm used by the HASH command.
+func (pconn *persistentConn) selectHash(algo string) error {
+	if pconn.hashAlgo == algo {
+		return nil
+	}
+
+	if err := pconn.sendCommandExpected(replyCommandOkay, "OPTS HASH %s", algo); err != nil {
+		return err
+	}
+
+	pconn.hashAlgo = algo
+	return nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(strings.Repeat("0", len(s)%2) + s)
+	return err == nil
+}
+
+// normalizeDigest lower cases digest and restores leading zeros some servers
+// leave out of CRCs.
+func normalizeDigest(digest string, hexLen int) string {
+	digest = strings.ToLower(digest)
+	if len(digest) < hexLen {
+		digest = strings.Repeat("0", hexLen-len(digest)) + digest
+	}
+	return digest
+}
+
+// WithVerifyHash makes Retrieve or Store hash the data locally as it is
+// transferred and compare the result with the server's hash of the file
+// (see Hash) once the transfer is done. Like the size check, verification
+// is skipped if the server can't compute the hash.
+func WithVerifyHash(algo string) TransferOption {
+	return func(o *transferOptions) {
+		o.verifyHash = strings.ToUpper(algo)
+	}
+}
+
+// newTransferHash returns a hash for WithVerifyHash, or nil if no hash was
+// requested.
+func (o transferOptions) newTransferHash() (hash.Hash, error) {
+	if o.verifyHash == "" {
+		return nil, nil
+	}
+
+	info, ok := hashAlgorithms[o.verifyHash]
+	if !ok {
+		return nil, ftpError{err: fmt.Errorf("unknown hash algorithm %s", o.verifyHash)}
+	}
+
+	return info.new(), nil
+}
+
+// verifyHash compares the local hash h of file "path" with the server's.
+func (c *Client) verifyHash(ctx context.Context, path, algo string, h hash.Hash) error {
+	if h == nil {
+		return nil
+	}
+
+	remote, err := c.serverHash(ctx, path, algo)
+	if err != nil {
+		return err
+	}
+
+	if remote == "" {
+		c.debug("skipping %s verification of %s", algo, path)
+		return nil
+	}
+
+	local := hex.EncodeToString(h.Sum(nil))
+	if local != remote {
+		return ftpError{
+			err:       fmt.Errorf("%s mismatch: local %s, server %s", algo, local, remote),
+			temporary: true,
+		}
+	}
+
+	return nil
+}
+
+// hashingWriter hashes the bytes successfully written to w.
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	return n, err
+}
+
+// hashingReader hashes the bytes read from r. Resumed uploads seek back to
+// re-read bytes that were already hashed, so it tracks the position in the
+// stream and hashes every byte once.
+type hashingReader struct {
+	r      io.Reader
+	h      hash.Hash
+	pos    int64
+	hashed int64
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+
+	if end := hr.pos + int64(n); end > hr.hashed {
+		start := int64(0)
+		if hr.pos < hr.hashed {
+			start = hr.hashed - hr.pos
+		}
+		hr.h.Write(p[start:n])
+		hr.hashed = end
+	}
+
+	hr.pos += int64(n)
+
+	return n, err
+}
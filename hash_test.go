@@ -0,0 +1,169 @@
+package goftp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func localHash(t *testing.T, algo, name string) string {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := hashAlgorithms[algo].new()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestHash(t *testing.T) {
+	algos := []string{HashCRC32, HashMD5, HashSHA1, HashSHA256, HashSHA512}
+
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, algo := range algos {
+			got, err := c.Hash("lorem.txt", algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if expected := localHash(t, algo, "testroot/lorem.txt"); got != expected {
+				t.Errorf("%s: got %s, expected %s", algo, got, expected)
+			}
+		}
+
+		_, err = c.Hash("doesnt-exist", HashSHA256)
+		if err == nil || err.(Error).Code() != 550 {
+			t.Errorf("Expected 550, got %v", err)
+		}
+
+		_, err = c.Hash("lorem.txt", "ROT13")
+		if err == nil {
+			t.Error("Expected error about unknown algorithm")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestHashFallback(t *testing.T) {
+	server := goftptest.NewUnstartedServer(goftptest.Dir("testroot"))
+	server.Disabled = []string{"HASH", "XSHA512"}
+	server.Start()
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algo := range []string{HashCRC32, HashMD5, HashSHA1, HashSHA256} {
+		got, err := c.Hash("lorem.txt", algo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := localHash(t, algo, "testroot/lorem.txt"); got != expected {
+			t.Errorf("%s: got %s, expected %s", algo, got, expected)
+		}
+	}
+
+	_, err = c.Hash("lorem.txt", HashSHA512)
+	if err == nil || !strings.Contains(err.Error(), "doesn't support") {
+		t.Errorf("Expected error about not supporting SHA-512, got %v", err)
+	}
+
+	// verification is skipped
+	err = c.Retrieve("lorem.txt", ioutil.Discard, WithVerifyHash(HashSHA512))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyHash(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.Retrieve("lorem.txt", ioutil.Discard, WithVerifyHash(HashMD5))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Remove("testroot/git-ignored/foo")
+
+		err = c.Store("git-ignored/foo", bytes.NewReader([]byte{1, 2, 3, 4}), WithVerifyHash(HashSHA1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		config := goftpConfig
+		config.stubResponses = map[string]stubResponse{
+			"HASH lorem.txt": {213, "SHA-256 0-10 " + strings.Repeat("0", 64) + " lorem.txt"},
+		}
+
+		c, err = DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.Retrieve("lorem.txt", ioutil.Discard, WithVerifyHash(HashSHA256))
+		if err == nil || !strings.Contains(err.Error(), "mismatch") {
+			t.Errorf("Expected mismatch, got %v", err)
+		}
+	}
+}
+
+// kill connections part way through upload to make sure resuming doesn't
+// throw off the local hash
+func TestVerifyHashResumeStore(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 10*1024*1024)
+		randomBytes(buf)
+
+		closed := false
+
+		seeker := &testSeeker{
+			buf: bytes.NewReader(buf),
+			cb: func(readSoFar int) {
+				if readSoFar > 5*1024*1024 && !closed {
+					time.Sleep(100 * time.Millisecond)
+					c.Close()
+					c.closed = false
+					closed = true
+				}
+			},
+		}
+
+		os.Remove("testroot/git-ignored/big")
+
+		err = c.Store("git-ignored/big", seeker, WithVerifyHash(HashSHA256))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !closed {
+			t.Error("Upload wasn't interrupted")
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package goftp
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var vmsNameRegex = regexp.MustCompile(`^(.+);(\d+)$`)
+
+// JoinVMSEntries rejoins the lines of VMS LIST responses whose name was too
+// long to share a line with the rest of the entry, for VMSListParser. Lines
+// in other formats are left alone. ReadDir and Stat do this for every LIST
+// response:
+//
+//	A_VERY_LONG_FILE_NAME.TXT;1
+//	                         1/3          28-JUL-2015 05:03:04  [GOFTP]  (RWED,RWED,RE,)
+func JoinVMSEntries(entries []string) []string {
+	joined := entries[:0:0]
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if i+1 < len(entries) && vmsNameRegex.MatchString(entry) && !strings.ContainsAny(entry, " \t") &&
+			strings.HasPrefix(entries[i+1], " ") {
+			entry += entries[i+1]
+			i++
+		}
+		joined = append(joined, entry)
+	}
+	return joined
+}
+
+// parseVMSLIST parses OpenVMS DIRECTORY/FULL style entries. Sizes are
+// reported in 512 byte blocks, so they are rounded up.
+//
+//	Directory DISK$USER:[GOFTP]
+//
+//	SUBDIR.DIR;1              1/3          16-JUN-2015 10:37:07  [GOFTP]    (RWE,RWE,RE,E)
+//	LOREM.TXT;2               2/3          28-JUL-2015 05:03:04  [GOFTP]    (RWED,RWED,RE,)
+//
+//	Total of 2 files, 3/6 blocks.
+func parseVMSLIST(entry string, loc *time.Location) (os.FileInfo, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	trimmed := strings.TrimSpace(entry)
+	if trimmed == "" || strings.HasPrefix(trimmed, "Directory ") || strings.HasPrefix(trimmed, "Total of ") {
+		return nil, nil
+	}
+
+	tokens := strings.Fields(entry)
+	if len(tokens) < 4 {
+		return nil, vmsError(entry)
+	}
+
+	name := vmsNameRegex.FindStringSubmatch(tokens[0])
+	if name == nil {
+		return nil, vmsError(entry)
+	}
+
+	// "used/allocated" blocks
+	blocks, err := strconv.ParseInt(strings.SplitN(tokens[1], "/", 2)[0], 10, 64)
+	if err != nil {
+		return nil, vmsError(entry)
+	}
+
+	// "28-JUL-2015 05:03:04", possibly with hundredths of a second
+	clock := strings.SplitN(tokens[3], ".", 2)[0]
+	var mtime time.Time
+	for _, layout := range []string{"2-Jan-2006 15:04:05", "2-Jan-2006 15:04"} {
+		mtime, err = time.ParseInLocation(layout, tokens[2]+" "+clock, loc)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's mtime: %s (%s)`, err, entry)}
+	}
+
+	// "(system,owner,group,world)", each made of R, W, E and D
+	mode := os.FileMode(0400)
+	for _, token := range tokens[4:] {
+		if !strings.HasPrefix(token, "(") || !strings.HasSuffix(token, ")") {
+			continue
+		}
+
+		classes := strings.Split(token[1:len(token)-1], ",")
+		if len(classes) != 4 {
+			return nil, vmsError(entry)
+		}
+
+		mode = 0
+		for i, class := range classes[1:] {
+			shift := 3 * uint(2-i)
+			if strings.Contains(class, "R") {
+				mode |= 04 << shift
+			}
+			if strings.Contains(class, "W") {
+				mode |= 02 << shift
+			}
+			if strings.Contains(class, "E") {
+				mode |= 01 << shift
+			}
+		}
+	}
+
+	filename := name[1]
+	if strings.HasSuffix(strings.ToUpper(filename), ".DIR") {
+		filename = filename[:len(filename)-len(".DIR")]
+		mode |= os.ModeDir
+	}
+
+	info := &ftpFile{
+		name:  filename,
+		size:  blocks * 512,
+		mode:  mode,
+		mtime: mtime,
+		raw:   entry,
+	}
+
+	return info, nil
+}
+
+func vmsError(entry string) error {
+	return ftpError{err: fmt.Errorf(`failed parsing VMS LIST entry: %s`, entry)}
+}
+
+var mvsDateRegex = regexp.MustCompile(`^\d{4}/\d{2}/\d{2}$`)
+
+// parseMVSLIST parses z/OS MVS listings of datasets and of partitioned
+// dataset (PDS) members. Partitioned datasets are reported as directories.
+// MVS doesn't list sizes in bytes, so sizes are left at 0; datasets' ModTimes
+// are their last reference dates.
+//
+//	Volume Unit    Referred Ext Used Recfm Lrecl BlkSz Dsorg Dsname
+//	WYNK01 3390   2015/07/28  1   15  FB      80  3120  PO  GOFTP.SOURCE
+//	WYNK01 3390   2015/07/28  1    1  FB      80  3120  PS  GOFTP.DATA
+//	Migrated                                                GOFTP.OLD
+//	Pseudo Directory                                        GOFTP.SUB
+//
+//	 Name     VV.MM   Created       Changed      Size  Init   Mod   Id
+//	MEMBER1   01.01 2015/07/28 2015/07/28 05:03    10    10     0 GOFTP
+//	LOADMOD
+func parseMVSLIST(entry string, loc *time.Location) (os.FileInfo, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	tokens := strings.Fields(entry)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	info := &ftpFile{
+		name: tokens[len(tokens)-1],
+		mode: 0400,
+		raw:  entry,
+	}
+
+	switch {
+	case tokens[0] == "Volume" && tokens[len(tokens)-1] == "Dsname", tokens[0] == "Name":
+		// headers
+		return nil, nil
+
+	case tokens[0] == "Pseudo" && len(tokens) == 3 && tokens[1] == "Directory":
+		info.mode |= os.ModeDir
+
+	case len(tokens) >= 10 && mvsDateRegex.MatchString(tokens[2]):
+		// dataset
+		mtime, err := time.ParseInLocation("2006/01/02", tokens[2], loc)
+		if err != nil {
+			return nil, mvsError(entry)
+		}
+		info.mtime = mtime
+
+		if strings.HasPrefix(tokens[len(tokens)-2], "PO") {
+			info.mode |= os.ModeDir
+		}
+
+	case len(tokens) >= 5 && strings.Count(tokens[1], ".") == 1 && mvsDateRegex.MatchString(tokens[3]):
+		// PDS member with ISPF statistics
+		info.name = tokens[0]
+
+		mtime, err := time.ParseInLocation("2006/01/02 15:04", tokens[3]+" "+tokens[4], loc)
+		if err != nil {
+			mtime, err = time.ParseInLocation("2006/01/02 15:04:05", tokens[3]+" "+tokens[4], loc)
+		}
+		if err != nil {
+			return nil, mvsError(entry)
+		}
+		info.mtime = mtime
+
+	case len(tokens) == 1, tokens[0] == "Migrated", strings.Contains(entry, "Not Direct Access Device"):
+		// members without statistics, datasets that aren't online
+		if len(tokens) != 1 {
+			info.name = tokens[len(tokens)-1]
+		}
+
+	default:
+		// load module members and the like, named in the first column
+		if len(tokens) < 2 || mvsDateRegex.MatchString(tokens[1]) {
+			return nil, mvsError(entry)
+		}
+
+		// leave listings of the Unix file system (USS) to parseLIST
+		if _, unix := parseLISTMode(tokens[0]); unix || tokens[0] == "total" {
+			return nil, mvsError(entry)
+		}
+		info.name = tokens[0]
+	}
+
+	info.name = strings.Trim(info.name, "'")
+
+	return info, nil
+}
+
+func mvsError(entry string) error {
+	return ftpError{err: fmt.Errorf(`failed parsing MVS LIST entry: %s`, entry)}
+}
+
+// OS/400 object types listed as directories
+var os400DirTypes = map[string]bool{
+	"*DIR":  true,
+	"*DDIR": true,
+	"*FLR":  true,
+	"*LIB":  true,
+	"*FILE": true,
+}
+
+// parseOS400LIST parses IBM i (OS/400) listings of the integrated file
+// system and of libraries. Database files (*FILE) are reported as
+// directories of their members (*MEM), which aren't listed with a size or
+// date.
+//
+//	QSYS           77824 02/23/00 15:09:55 *DIR       QDLS/
+//	GOFTP           1234 07/28/15 05:03:04 *STMF      lorem.txt
+//	GOFTP          36864 07/28/15 05:03:04 *FILE      GOFTPLIB/QCLSRC.FILE
+//	GOFTP                                  *MEM       GOFTPLIB/QCLSRC.FILE/MEMBER1.MBR
+func parseOS400LIST(entry string, loc *time.Location) (os.FileInfo, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	tokens := tokenizeLIST(entry)
+	if len(tokens) < 3 {
+		return nil, os400Error(entry)
+	}
+
+	info := &ftpFile{
+		mode: 0400,
+		raw:  entry,
+	}
+
+	var typeIdx int
+	if strings.HasPrefix(tokens[1].text, "*") {
+		// members have no size or date
+		typeIdx = 1
+	} else {
+		if len(tokens) < 6 || !strings.HasPrefix(tokens[4].text, "*") {
+			return nil, os400Error(entry)
+		}
+
+		size, err := strconv.ParseInt(tokens[1].text, 10, 64)
+		if err != nil {
+			return nil, os400Error(entry)
+		}
+		info.size = size
+
+		var mtime time.Time
+		for _, layout := range []string{"01/02/06 15:04:05", "02.01.06 15:04:05", "06-01-02 15:04:05"} {
+			mtime, err = time.ParseInLocation(layout, tokens[2].text+" "+tokens[3].text, loc)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's mtime: %s (%s)`, err, entry)}
+		}
+		info.mtime = mtime
+
+		typeIdx = 4
+	}
+
+	if typeIdx+1 >= len(tokens) {
+		return nil, os400Error(entry)
+	}
+
+	if os400DirTypes[tokens[typeIdx].text] {
+		info.mode |= os.ModeDir
+	}
+
+	info.name = path.Base(strings.TrimRight(entry[tokens[typeIdx+1].start:], " /"))
+
+	return info, nil
+}
+
+func os400Error(entry string) error {
+	return ftpError{err: fmt.Errorf(`failed parsing OS/400 LIST entry: %s`, entry)}
+}
@@ -0,0 +1,254 @@
+package goftp
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseVMSLIST(t *testing.T) {
+	cases := []struct {
+		raw string
+		exp *ftpFile
+	}{
+		{
+			"SUBDIR.DIR;1              1/3          16-JUN-2015 10:37:07  [GOFTP]    (RWE,RWE,RE,E)",
+			&ftpFile{
+				name:  "SUBDIR",
+				mtime: time.Date(2015, 6, 16, 10, 37, 7, 0, time.UTC),
+				mode:  os.FileMode(0751) | os.ModeDir,
+				size:  512,
+			},
+		},
+		{
+			"LOREM.TXT;2               2/3          28-JUL-2015 05:03:04.12  [GROUP,GOFTP]    (RWED,RWED,RE,)",
+			&ftpFile{
+				name:  "LOREM.TXT",
+				mtime: time.Date(2015, 7, 28, 5, 3, 4, 0, time.UTC),
+				mode:  os.FileMode(0750),
+				size:  1024,
+			},
+		},
+		{
+			// no owner or protection
+			"1234.BIN;1  1  28-JUL-2015 05:03",
+			&ftpFile{
+				name:  "1234.BIN",
+				mtime: time.Date(2015, 7, 28, 5, 3, 0, 0, time.UTC),
+				mode:  os.FileMode(0400),
+				size:  512,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c.exp.raw = c.raw
+
+		got, err := parseVMSLIST(c.raw, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("got %+v, expected %+v", got, c.exp)
+		}
+	}
+
+	for _, skip := range []string{"", "Directory DISK$USER:[GOFTP]", "Total of 2 files, 3/6 blocks."} {
+		if info, err := parseVMSLIST(skip, time.UTC); info != nil || err != nil {
+			t.Errorf("%q: got %v, %v", skip, info, err)
+		}
+	}
+
+	for _, bad := range []string{
+		"-rw-r--r--   1 goftp    20            4 Jul 28  2015 1234.bin",
+		"LOREM.TXT 2/3 28-JUL-2015 05:03:04",
+		"LOREM.TXT;2 2/3 28-JUL-2015 05:03:04 [GOFTP] (RWED,RWED)",
+	} {
+		if _, err := parseVMSLIST(bad, time.UTC); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestJoinVMSEntries(t *testing.T) {
+	got := JoinVMSEntries([]string{
+		"Directory DISK$USER:[GOFTP]",
+		"A_VERY_LONG_FILE_NAME.TXT;1",
+		"                         1/3          28-JUL-2015 05:03:04",
+		"LOREM.TXT;2               2/3          28-JUL-2015 05:03:04",
+	})
+
+	exp := []string{
+		"Directory DISK$USER:[GOFTP]",
+		"A_VERY_LONG_FILE_NAME.TXT;1                         1/3          28-JUL-2015 05:03:04",
+		"LOREM.TXT;2               2/3          28-JUL-2015 05:03:04",
+	}
+
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestParseMVSLIST(t *testing.T) {
+	cases := []struct {
+		raw string
+		exp *ftpFile
+	}{
+		{
+			"WYNK01 3390   2015/07/28  1   15  FB      80  3120  PO  GOFTP.SOURCE",
+			&ftpFile{
+				name:  "GOFTP.SOURCE",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0400) | os.ModeDir,
+			},
+		},
+		{
+			"WYNK01 3390   2015/07/28  1    1  FB      80  3120  PS  GOFTP.DATA",
+			&ftpFile{
+				name:  "GOFTP.DATA",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0400),
+			},
+		},
+		{
+			"Migrated                                                GOFTP.OLD",
+			&ftpFile{name: "GOFTP.OLD", mode: os.FileMode(0400)},
+		},
+		{
+			"Pseudo Directory                                        GOFTP.SUB",
+			&ftpFile{name: "GOFTP.SUB", mode: os.FileMode(0400) | os.ModeDir},
+		},
+		{
+			"MEMBER1   01.01 2015/07/28 2015/07/28 05:03    10    10     0 GOFTP",
+			&ftpFile{
+				name:  "MEMBER1",
+				mtime: time.Date(2015, 7, 28, 5, 3, 0, 0, time.UTC),
+				mode:  os.FileMode(0400),
+			},
+		},
+		{
+			"MEMBER2",
+			&ftpFile{name: "MEMBER2", mode: os.FileMode(0400)},
+		},
+		{
+			"LOADMOD  000AE8 000AE8   00                 31    ANY",
+			&ftpFile{name: "LOADMOD", mode: os.FileMode(0400)},
+		},
+	}
+
+	for _, c := range cases {
+		c.exp.raw = c.raw
+
+		got, err := parseMVSLIST(c.raw, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("got %+v, expected %+v", got, c.exp)
+		}
+	}
+
+	for _, skip := range []string{
+		"Volume Unit    Referred Ext Used Recfm Lrecl BlkSz Dsorg Dsname",
+		" Name     VV.MM   Created       Changed      Size  Init   Mod   Id",
+	} {
+		if info, err := parseMVSLIST(skip, time.UTC); info != nil || err != nil {
+			t.Errorf("%q: got %v, %v", skip, info, err)
+		}
+	}
+}
+
+func TestParseMVSLISTUnix(t *testing.T) {
+	for _, unix := range []string{
+		"total 8",
+		"drwxr-xr-x   8 goftp    20            272 Jul 28 05:03 git-ignored",
+		"-rw-r--r--   1 goftp    20             12 Jul 28  2015 lorem.txt",
+	} {
+		if info, err := parseMVSLIST(unix, time.UTC); err == nil {
+			t.Errorf("%q: expected error, got %+v", unix, info)
+		}
+	}
+
+	// z/OS servers list their Unix file system in the Unix format
+	c := newClient(Config{}, []string{"mvs"})
+	c.listFormats["mvs"] = &listFormat{systemQueried: true, system: MVSListParser}
+
+	for _, entry := range []struct{ raw, name string }{
+		{"WYNK01 3390   2015/07/28  1   15  FB      80  3120  PO  GOFTP.SOURCE", "GOFTP.SOURCE"},
+		{"drwxr-xr-x   8 goftp    20            272 Jul 28 05:03 git-ignored", "git-ignored"},
+	} {
+		info, err := c.parseLISTEntry("mvs", entry.raw, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.IsDir() || info.Name() != entry.name {
+			t.Errorf("got %+v", info)
+		}
+	}
+}
+
+func TestParseOS400LIST(t *testing.T) {
+	cases := []struct {
+		raw string
+		exp *ftpFile
+	}{
+		{
+			"QSYS           77824 02/23/00 15:09:55 *DIR       QDLS/",
+			&ftpFile{
+				name:  "QDLS",
+				mtime: time.Date(2000, 2, 23, 15, 9, 55, 0, time.UTC),
+				mode:  os.FileMode(0400) | os.ModeDir,
+				size:  77824,
+			},
+		},
+		{
+			"GOFTP           1234 07/28/15 05:03:04 *STMF      lorem ipsum.txt",
+			&ftpFile{
+				name:  "lorem ipsum.txt",
+				mtime: time.Date(2015, 7, 28, 5, 3, 4, 0, time.UTC),
+				mode:  os.FileMode(0400),
+				size:  1234,
+			},
+		},
+		{
+			"GOFTP          36864 28.07.15 05:03:04 *FILE      GOFTPLIB/QCLSRC.FILE",
+			&ftpFile{
+				name:  "QCLSRC.FILE",
+				mtime: time.Date(2015, 7, 28, 5, 3, 4, 0, time.UTC),
+				mode:  os.FileMode(0400) | os.ModeDir,
+				size:  36864,
+			},
+		},
+		{
+			"GOFTP                                  *MEM       GOFTPLIB/QCLSRC.FILE/MEMBER1.MBR",
+			&ftpFile{name: "MEMBER1.MBR", mode: os.FileMode(0400)},
+		},
+	}
+
+	for _, c := range cases {
+		c.exp.raw = c.raw
+
+		got, err := parseOS400LIST(c.raw, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, c.exp) {
+			t.Errorf("got %+v, expected %+v", got, c.exp)
+		}
+	}
+
+	for _, bad := range []string{
+		"-rw-r--r--   1 goftp    20            4 Jul 28  2015 1234.bin",
+		"GOFTP 1234 07/28/15 05:03:04 *STMF",
+		"GOFTP big 07/28/15 05:03:04 *STMF lorem.txt",
+	} {
+		if _, err := parseOS400LIST(bad, time.UTC); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
@@ -0,0 +1,540 @@
+package goftp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListParser parses the entries of LIST responses, whose format isn't
+// standardized. Set Config.ListParser to support servers the built-in
+// parsers don't understand.
+type ListParser interface {
+	// ParseEntry parses a single line of a LIST response. Times without a
+	// time zone are in loc. It returns a nil os.FileInfo and a nil error for
+	// lines that don't describe a file, such as "total 123".
+	ParseEntry(entry string, loc *time.Location) (os.FileInfo, error)
+}
+
+// ListParserFunc adapts an ordinary function to the ListParser interface.
+type ListParserFunc func(entry string, loc *time.Location) (os.FileInfo, error)
+
+// ParseEntry calls f(entry, loc).
+func (f ListParserFunc) ParseEntry(entry string, loc *time.Location) (os.FileInfo, error) {
+	return f(entry, loc)
+}
+
+// ListParserChain is a ListParser trying each of its parsers in turn until
+// one of them succeeds.
+type ListParserChain []ListParser
+
+// ParseEntry implements ListParser.
+func (chain ListParserChain) ParseEntry(entry string, loc *time.Location) (os.FileInfo, error) {
+	for _, parser := range chain {
+		if info, err := parser.ParseEntry(entry, loc); err == nil {
+			return info, nil
+		}
+	}
+
+	return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry: %s`, entry)}
+}
+
+// The built-in LIST parsers. They take a nil time.Location to mean UTC.
+// ParseMLSTEntry parses "MLST"/"MLSD" entries.
+var (
+	// UnixListParser parses the Unix "ls -l" format and its many variants.
+	UnixListParser ListParser = ListParserFunc(parseLIST)
+
+	// DOSListParser parses the DOS format used by IIS.
+	DOSListParser ListParser = ListParserFunc(parseDOSLIST)
+
+	// VMSListParser parses the OpenVMS "DIRECTORY/FULL" format. Entries
+	// whose name doesn't fit on one line must be joined with the next line
+	// first, see JoinVMSEntries.
+	VMSListParser ListParser = ListParserFunc(parseVMSLIST)
+
+	// MVSListParser parses z/OS MVS dataset and PDS member listings.
+	MVSListParser ListParser = ListParserFunc(parseMVSLIST)
+
+	// OS400ListParser parses IBM i (OS/400) listings.
+	OS400ListParser ListParser = ListParserFunc(parseOS400LIST)
+)
+
+// LIST formats recognizable on their own, most common first. Formats that
+// are too ambiguous to guess, like MVS, are only used when the server's
+// SYST reply names them (see systemListParsers).
+var listParsers = []ListParser{UnixListParser, DOSListParser, VMSListParser}
+
+// systemListParsers maps the first word of SYST replies to the LIST format
+// such servers use by default.
+var systemListParsers = map[string]ListParser{
+	"UNIX":       UnixListParser,
+	"WINDOWS_NT": DOSListParser,
+	"VMS":        VMSListParser,
+	"MVS":        MVSListParser,
+	"OS/400":     OS400ListParser,
+}
+
+// listFormat tracks the LIST format of a host.
+type listFormat struct {
+	// SYST has been sent
+	systemQueried bool
+
+	// parser suggested by the SYST reply, if any
+	system ListParser
+
+	// parser that last worked
+	detected ListParser
+}
+
+// listFormat returns the LIST format state of host. c.mu must be held.
+func (c *Client) listFormat(host string) *listFormat {
+	f := c.listFormats[host]
+	if f == nil {
+		f = &listFormat{}
+		c.listFormats[host] = f
+	}
+	return f
+}
+
+// prepareLIST readies the lines of a LIST response from pconn's server for
+// parseLISTEntry. It rejoins VMS entries split over two lines and, unless a
+// custom ListParser is configured, asks the server for its system type.
+func (c *Client) prepareLIST(pconn *persistentConn, lines []string) []string {
+	if c.config.ListParser == nil {
+		c.querySystem(pconn)
+	}
+
+	return JoinVMSEntries(lines)
+}
+
+// querySystem asks pconn's server for its system type with SYST, once per
+// host, to pick the LIST format to try first.
+func (c *Client) querySystem(pconn *persistentConn) {
+	c.mu.Lock()
+	queried := c.listFormat(pconn.host).systemQueried
+	c.mu.Unlock()
+
+	if queried {
+		return
+	}
+
+	var system ListParser
+
+	// "UNIX Type: L8", "MVS is the operating system of this server..."
+	code, msg, err := pconn.sendCommand("SYST")
+	if err != nil {
+		pconn.debug("error sending SYST: %s", err)
+		return
+	}
+
+	if code == replySystemType {
+		if fields := strings.Fields(msg); len(fields) > 0 {
+			system = systemListParsers[strings.ToUpper(fields[0])]
+		}
+	} else {
+		pconn.debug("unexpected SYST response: %d-%s", code, msg)
+	}
+
+	c.mu.Lock()
+	f := c.listFormat(pconn.host)
+	f.systemQueried = true
+	f.system = system
+	c.mu.Unlock()
+}
+
+// parseLISTEntry parses LIST entries from host with Config.ListParser, if
+// set. Otherwise, as servers don't say which format they use, the built-in
+// parsers are tried in turn, starting with the one that last worked for host
+// and the one suggested by its SYST reply.
+func (c *Client) parseLISTEntry(host, entry string, skipSelfParent bool) (os.FileInfo, error) {
+	info, err := c.parseLISTEntryFormat(host, entry)
+	if err != nil || info == nil {
+		return nil, err
+	}
+
+	if skipSelfParent && (info.Name() == "." || info.Name() == "..") {
+		return nil, nil
+	}
+
+	return info, nil
+}
+
+func (c *Client) parseLISTEntryFormat(host, entry string) (os.FileInfo, error) {
+	loc := c.config.ServerLocation
+
+	if c.config.ListParser != nil {
+		return c.config.ListParser.ParseEntry(entry, loc)
+	}
+
+	c.mu.Lock()
+	f := c.listFormat(host)
+	candidates := append([]ListParser{f.detected, f.system}, listParsers...)
+	c.mu.Unlock()
+
+	for _, parser := range candidates {
+		if parser == nil {
+			continue
+		}
+
+		info, err := parser.ParseEntry(entry, loc)
+		if err != nil {
+			continue
+		}
+
+		if info != nil {
+			c.mu.Lock()
+			f.detected = parser
+			c.mu.Unlock()
+		}
+
+		return info, nil
+	}
+
+	return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry: %s`, entry)}
+}
+
+// listToken is a whitespace separated field of a LIST entry, with its
+// position so the file name can be cut out of the entry verbatim.
+type listToken struct {
+	text       string
+	start, end int
+}
+
+func tokenizeLIST(entry string) []listToken {
+	var tokens []listToken
+	start := -1
+	for i := 0; i <= len(entry); i++ {
+		if i == len(entry) || entry[i] == ' ' || entry[i] == '\t' {
+			if start >= 0 {
+				tokens = append(tokens, listToken{entry[start:i], start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return tokens
+}
+
+var listMonths = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March,
+	"apr": time.April, "may": time.May, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September,
+	"oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// parseLIST parses the Unix "ls -l" format, including its many variants:
+//
+//	total 404456
+//	drwxr-xr-x   8 goftp    20            272 Jul 28 05:03 git-ignored
+//	-rw-r--r--+  1 1000              1234 Jul 28  2015  leading spaces.txt
+//	crw-rw----   1 root     tty        4,  64 Jul 28 05:03 tty0
+//	lrwxrwxrwx   1 goftp    goftp          7 2015-07-28 05:03 link -> lorem.txt
+//
+// The owner and group columns are optional, as their content varies too
+// much to rely on. Instead the entry is scanned for the date, which is
+// preceded by the size and followed by the name.
+func parseLIST(entry string, loc *time.Location) (os.FileInfo, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if strings.HasPrefix(entry, "total ") {
+		return nil, nil
+	}
+
+	tokens := tokenizeLIST(entry)
+	if len(tokens) < 4 {
+		return nil, listError(entry)
+	}
+
+	mode, ok := parseLISTMode(tokens[0].text)
+	if !ok {
+		return nil, listError(entry)
+	}
+
+	// devices have "major, minor" or "major,minor" instead of a size
+	device := mode&os.ModeDevice != 0
+	isSize := func(s string) bool {
+		return isDigits(s) || device && isDigits(strings.Replace(s, ",", "", 1))
+	}
+
+	var (
+		mtime   time.Time
+		nameIdx = -1
+		sizeIdx int
+	)
+	for i := 2; i < len(tokens)-1; i++ {
+		var n int
+		mtime, n = parseLISTTime(tokens[i:], loc)
+		if n == 0 || !isSize(tokens[i-1].text) {
+			continue
+		}
+		sizeIdx, nameIdx = i-1, i+n
+		break
+	}
+
+	if nameIdx < 0 || nameIdx >= len(tokens) {
+		return nil, listError(entry)
+	}
+
+	// exactly one space separates the name from the date, any others are
+	// part of the name
+	name := entry[tokens[nameIdx-1].end+1:]
+
+	var size int64
+	if !device {
+		var err error
+		size, err = strconv.ParseInt(tokens[sizeIdx].text, 10, 64)
+		if err != nil {
+			return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's size: %s (%s)`, err, entry)}
+		}
+	}
+
+	var link string
+	if mode&os.ModeSymlink != 0 {
+		if i := strings.Index(name, " -> "); i >= 0 {
+			name, link = name[:i], name[i+len(" -> "):]
+		}
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return nil, listError(entry)
+	}
+
+	info := &ftpFile{
+		name:  filepath.Base(name),
+		mode:  mode,
+		mtime: mtime,
+		raw:   entry,
+		size:  size,
+		link:  link,
+	}
+
+	return info, nil
+}
+
+func listError(entry string) error {
+	return ftpError{err: fmt.Errorf(`failed parsing LIST entry: %s`, entry)}
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLISTMode parses permissions like "drwxr-sr-t", which may be followed
+// by an ACL or extended attribute marker ("+", "@" or ".").
+func parseLISTMode(perms string) (os.FileMode, bool) {
+	if len(perms) == 11 && strings.ContainsRune("+@.", rune(perms[10])) {
+		perms = perms[:10]
+	}
+
+	if len(perms) != 10 {
+		return 0, false
+	}
+
+	var mode os.FileMode
+	switch perms[0] {
+	case '-':
+	case 'd':
+		mode |= os.ModeDir
+	case 'l':
+		mode |= os.ModeSymlink
+	case 'c':
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 'b':
+		mode |= os.ModeDevice
+	case 'p':
+		mode |= os.ModeNamedPipe
+	case 's':
+		mode |= os.ModeSocket
+	default:
+		return 0, false
+	}
+
+	// setuid, setgid and sticky show up in place of the execute bits, upper
+	// case if the execute bit isn't set
+	special := [3]os.FileMode{os.ModeSetuid, os.ModeSetgid, os.ModeSticky}
+
+	for i := 0; i < 3; i++ {
+		rwx := perms[1+3*i : 4+3*i]
+		shift := 3 * uint(2-i)
+
+		switch rwx[0] {
+		case 'r':
+			mode |= 04 << shift
+		case '-':
+		default:
+			return 0, false
+		}
+
+		switch rwx[1] {
+		case 'w':
+			mode |= 02 << shift
+		case '-':
+		default:
+			return 0, false
+		}
+
+		switch rwx[2] {
+		case 'x':
+			mode |= 01 << shift
+		case 's', 't':
+			mode |= 01<<shift | special[i]
+		case 'S', 'T':
+			mode |= special[i]
+		case '-':
+		default:
+			return 0, false
+		}
+	}
+
+	return mode, true
+}
+
+// parseLISTTime parses the date at the start of tokens, returning the
+// number of tokens it spans, or 0 if there's no date. Dates look like
+// "Jul 28 05:03" (within the last six months), "Jul 28 2015" or, with
+// "ls --time-style", "2015-07-28 05:03", "2015-07-28 05:03:12.000000000
+// +0000" or "2015-07-28".
+func parseLISTTime(tokens []listToken, loc *time.Location) (time.Time, int) {
+	if month, ok := listMonths[strings.ToLower(tokens[0].text)]; ok && len(tokens) >= 3 {
+		day, err := strconv.Atoi(tokens[1].text)
+		if err != nil || day < 1 || day > 31 {
+			return time.Time{}, 0
+		}
+
+		if year, err := strconv.Atoi(tokens[2].text); err == nil && len(tokens[2].text) == 4 {
+			return time.Date(year, month, day, 0, 0, 0, 0, loc), 3
+		}
+
+		clock, err := time.Parse("15:04", tokens[2].text)
+		if err != nil {
+			return time.Time{}, 0
+		}
+
+		// the year is left out for recent files, so it's this year unless
+		// that would be in the future
+		now := time.Now()
+		year := now.Year()
+		if month > now.Month() {
+			year--
+		}
+
+		return time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, loc), 3
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", tokens[0].text, loc)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	if len(tokens) >= 2 {
+		for _, layout := range []string{"15:04", "15:04:05", "15:04:05.999999999"} {
+			clock, err := time.Parse(layout, tokens[1].text)
+			if err != nil {
+				continue
+			}
+
+			// full-iso includes the zone
+			n, zoneLoc := 2, loc
+			if len(tokens) >= 3 {
+				if zone, err := time.Parse("-0700", tokens[2].text); err == nil {
+					n, zoneLoc = 3, zone.Location()
+				}
+			}
+
+			y, m, d := date.Date()
+			return time.Date(y, m, d, clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), zoneLoc), n
+		}
+	}
+
+	return date, 1
+}
+
+var dosListRegex = regexp.MustCompile(`^\s*(\d{2})-(\d{2})-(\d{2}|\d{4})\s+(\d{1,2}):(\d{2})\s*([AaPp][Mm])?\s+(<DIR>|\d+)\s+(.+)$`)
+
+// 02-16-15  08:41AM       <DIR>          git-ignored
+// 07-28-2015  17:03                 1234 lorem.txt
+func parseDOSLIST(entry string, loc *time.Location) (os.FileInfo, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	matches := dosListRegex.FindStringSubmatch(entry)
+	if len(matches) == 0 {
+		return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry: %s`, entry)}
+	}
+
+	// the regex guarantees these are numbers
+	month, _ := strconv.Atoi(matches[1])
+	day, _ := strconv.Atoi(matches[2])
+	year, _ := strconv.Atoi(matches[3])
+	hour, _ := strconv.Atoi(matches[4])
+	min, _ := strconv.Atoi(matches[5])
+
+	if len(matches[3]) == 2 {
+		// same pivot as time.Parse's "06"
+		if year < 69 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+
+	switch matches[6] {
+	case "":
+		if hour > 23 {
+			return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's mtime: %s`, entry)}
+		}
+	default:
+		if hour < 1 || hour > 12 {
+			return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's mtime: %s`, entry)}
+		}
+		hour %= 12
+		if matches[6][0] == 'P' || matches[6][0] == 'p' {
+			hour += 12
+		}
+	}
+
+	if month < 1 || month > 12 || day < 1 || day > 31 || min > 59 {
+		return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's mtime: %s`, entry)}
+	}
+
+	// no permissions in this format, just say it's readable to us
+	mode := os.FileMode(0400)
+
+	var size int64
+	if matches[7] == "<DIR>" {
+		mode |= os.ModeDir
+	} else {
+		var err error
+		size, err = strconv.ParseInt(matches[7], 10, 64)
+		if err != nil {
+			return nil, ftpError{err: fmt.Errorf(`failed parsing LIST entry's size: %s (%s)`, err, entry)}
+		}
+	}
+
+	info := &ftpFile{
+		name:  filepath.Base(matches[8]),
+		mode:  mode,
+		mtime: time.Date(year, time.Month(month), day, hour, min, 0, 0, loc),
+		raw:   entry,
+		size:  size,
+	}
+
+	return info, nil
+}
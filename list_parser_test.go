@@ -0,0 +1,376 @@
+package goftp
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLIST(t *testing.T) {
+	cases := []struct {
+		raw string
+		exp *ftpFile
+	}{
+		{
+			"drwxr-xr-x   8 goftp    20            272 Jul 28  2015 git-ignored",
+			&ftpFile{
+				name:  "git-ignored",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0755) | os.ModeDir,
+				size:  272,
+			},
+		},
+		{
+			// leading spaces in the name
+			"-rw-r--r--   1 goftp    goftp         4 Jul 28  2015   spaced out ",
+			&ftpFile{
+				name:  "  spaced out ",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0644),
+				size:  4,
+			},
+		},
+		{
+			// no group column, numeric owner
+			"-rw-r--r--   1 1000          1234 Feb  3  2014 nogroup.txt",
+			&ftpFile{
+				name:  "nogroup.txt",
+				mtime: time.Date(2014, 2, 3, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0644),
+				size:  1234,
+			},
+		},
+		{
+			// character device
+			"crw-rw----   1 root     tty        4,  64 Jan  1  2015 tty0",
+			&ftpFile{
+				name:  "tty0",
+				mtime: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0660) | os.ModeDevice | os.ModeCharDevice,
+			},
+		},
+		{
+			// block device without the space
+			"brw-rw----   1 root     disk       8,0 Jan  1  2015 sda",
+			&ftpFile{
+				name:  "sda",
+				mtime: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0660) | os.ModeDevice,
+			},
+		},
+		{
+			// ACL marker
+			"-rw-r--r--+  1 goftp    goftp        10 Mar 10  2016 acl.txt",
+			&ftpFile{
+				name:  "acl.txt",
+				mtime: time.Date(2016, 3, 10, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0644),
+				size:  10,
+			},
+		},
+		{
+			// extended attributes marker
+			"-rwxr-xr-x@  1 goftp    staff        10 Mar 10  2016 xattr",
+			&ftpFile{
+				name:  "xattr",
+				mtime: time.Date(2016, 3, 10, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0755),
+				size:  10,
+			},
+		},
+		{
+			// symlink, long-iso time style
+			"lrwxrwxrwx   1 goftp    goftp         9 2015-07-28 05:03 link -> lorem.txt",
+			&ftpFile{
+				name:  "link",
+				mtime: time.Date(2015, 7, 28, 5, 3, 0, 0, time.UTC),
+				mode:  os.FileMode(0777) | os.ModeSymlink,
+				size:  9,
+				link:  "lorem.txt",
+			},
+		},
+		{
+			// full-iso time style
+			"-rw-r--r--   1 goftp    goftp         4 2015-07-28 05:03:12.500000000 +0000 full.txt",
+			&ftpFile{
+				name:  "full.txt",
+				mtime: time.Date(2015, 7, 28, 5, 3, 12, 500000000, time.UTC),
+				mode:  os.FileMode(0644),
+				size:  4,
+			},
+		},
+		{
+			// iso time style for old files
+			"-rw-r--r--   1 goftp    goftp         4 2015-07-28 iso.txt",
+			&ftpFile{
+				name:  "iso.txt",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0644),
+				size:  4,
+			},
+		},
+		{
+			"-rwsr-sr-T   1 root     root          4 Jul 28  2015 special",
+			&ftpFile{
+				name:  "special",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0754) | os.ModeSetuid | os.ModeSetgid | os.ModeSticky,
+				size:  4,
+			},
+		},
+		{
+			"prw-r--r--   1 goftp    goftp         0 Jul 28  2015 fifo",
+			&ftpFile{
+				name:  "fifo",
+				mtime: time.Date(2015, 7, 28, 0, 0, 0, 0, time.UTC),
+				mode:  os.FileMode(0644) | os.ModeNamedPipe,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c.exp.raw = c.raw
+
+		got, err := parseLIST(c.raw, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotFile := got.(*ftpFile)
+		if !gotFile.mtime.Equal(c.exp.mtime) {
+			t.Errorf("%s: got mtime %s", c.raw, gotFile.mtime)
+		}
+		gotFile.mtime = c.exp.mtime
+		if !reflect.DeepEqual(gotFile, c.exp) {
+			t.Errorf("exp %+v\n got %+v", c.exp, gotFile)
+		}
+	}
+
+	// recent files have a time instead of the year
+	now := time.Now().UTC()
+	got, err := parseLIST(now.Format("-rw-r--r--   1 goftp    goftp         4 Jan _2 15:04 recent"), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := now.Truncate(time.Minute); !got.ModTime().Equal(exp) {
+		t.Errorf("got %s, expected %s", got.ModTime(), exp)
+	}
+
+	if info, err := parseLIST("total 404456", time.UTC); info != nil || err != nil {
+		t.Errorf("expected total to be skipped, got %v %v", info, err)
+	}
+
+	for _, bad := range []string{
+		"drwxr-xr-x   8 goftp    20            272 Jul 28  2015",
+		"drwxr-xr-x   8 goftp    20            abc Jul 28  2015 nosize",
+		"dr?xr-xr-x   8 goftp    20            272 Jul 28  2015 perms",
+		"02-16-15  08:41AM       <DIR>          git-ignored",
+	} {
+		if _, err := parseLIST(bad, time.UTC); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestParseDOSLIST(t *testing.T) {
+	cases := []struct {
+		raw string
+		exp *ftpFile
+	}{
+		{
+			"02-16-15  08:41AM       <DIR>          git-ignored",
+			&ftpFile{
+				name:  "git-ignored",
+				mtime: time.Date(2015, 2, 16, 8, 41, 0, 0, time.UTC),
+				mode:  os.FileMode(0400) | os.ModeDir,
+			},
+		},
+		{
+			"10-14-99  07:26PM                 1234 lorem ipsum.txt",
+			&ftpFile{
+				name:  "lorem ipsum.txt",
+				mtime: time.Date(1999, 10, 14, 19, 26, 0, 0, time.UTC),
+				mode:  os.FileMode(0400),
+				size:  1234,
+			},
+		},
+		{
+			// midnight
+			"01-01-20  12:05AM                    0 empty",
+			&ftpFile{
+				name:  "empty",
+				mtime: time.Date(2020, 1, 1, 0, 5, 0, 0, time.UTC),
+				mode:  os.FileMode(0400),
+			},
+		},
+		{
+			// 24 hour clock, four digit year
+			"07-28-2015  17:03                 4 1234.bin",
+			&ftpFile{
+				name:  "1234.bin",
+				mtime: time.Date(2015, 7, 28, 17, 3, 0, 0, time.UTC),
+				mode:  os.FileMode(0400),
+				size:  4,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c.exp.raw = c.raw
+
+		got, err := parseDOSLIST(c.raw, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotFile := got.(*ftpFile)
+		if !reflect.DeepEqual(gotFile, c.exp) {
+			t.Errorf("exp %+v\n got %+v", c.exp, gotFile)
+		}
+	}
+
+	for _, bad := range []string{
+		"drwxr-xr-x   8 goftp    20            272 Jul 28 05:03 git-ignored",
+		"13-16-15  08:41AM       <DIR>          month",
+		"02-16-15  13:41AM       <DIR>          hour",
+		"02-16-15  24:41         <DIR>          hour",
+	} {
+		if _, err := parseDOSLIST(bad, time.UTC); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestParseLISTEntryDetection(t *testing.T) {
+	c := newClient(Config{}, []string{"unix", "dos"})
+
+	unix := "-rw-r--r--   1 goftp    20            4 Jul 28  2015 1234.bin"
+	dos := "07-28-15  05:03PM                    4 1234.bin"
+
+	for _, entry := range []struct{ host, raw string }{{"unix", unix}, {"dos", dos}, {"dos", dos}} {
+		info, err := c.parseLISTEntry(entry.host, entry.raw, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name() != "1234.bin" || info.Size() != 4 {
+			t.Errorf("got %s (%d bytes)", info.Name(), info.Size())
+		}
+	}
+
+	if reflect.ValueOf(c.listFormats["dos"].detected).Pointer() != reflect.ValueOf(DOSListParser).Pointer() {
+		t.Error("DOS format wasn't detected")
+	}
+
+	if _, err := c.parseLISTEntry("dos", "garbage", false); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestParseLISTEntrySkipSelfParent(t *testing.T) {
+	c := newClient(Config{}, []string{"unix"})
+
+	for _, name := range []string{".", ".."} {
+		entry := "drwxr-xr-x   8 goftp    20            272 Jul 28  2015 " + name
+
+		if info, err := c.parseLISTEntry("unix", entry, true); info != nil || err != nil {
+			t.Errorf("expected %q to be skipped, got %v %v", name, info, err)
+		}
+
+		info, err := c.parseLISTEntry("unix", entry, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name() != name {
+			t.Errorf("got %q", info.Name())
+		}
+	}
+}
+
+func TestListParserChain(t *testing.T) {
+	appliance := ListParserFunc(func(entry string, loc *time.Location) (os.FileInfo, error) {
+		fields := strings.Fields(entry)
+		if len(fields) != 3 || fields[0] != "FILE" {
+			return nil, errors.New("not an appliance entry")
+		}
+
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ftpFile{name: fields[1], size: size, mode: 0644, raw: entry}, nil
+	})
+
+	chain := ListParserChain{appliance, UnixListParser}
+
+	info, err := chain.ParseEntry("FILE lorem.txt 1234", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "lorem.txt" || info.Size() != 1234 {
+		t.Errorf("got %s (%d bytes)", info.Name(), info.Size())
+	}
+
+	info, err = chain.ParseEntry("-rw-r--r--   1 goftp    20            4 Jul 28  2015 1234.bin", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "1234.bin" || info.Size() != 4 {
+		t.Errorf("got %s (%d bytes)", info.Name(), info.Size())
+	}
+
+	if _, err := chain.ParseEntry("07-28-15  05:03PM                    4 1234.bin", time.UTC); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestListParsersNilLocation(t *testing.T) {
+	for _, c := range []struct {
+		parser ListParser
+		entry  string
+	}{
+		{UnixListParser, "-rw-r--r--   1 goftp    20            4 Jul 28  2015 1234.bin"},
+		{UnixListParser, "-rw-r--r--   1 goftp    20            4 Jul 28 05:03 1234.bin"},
+		{DOSListParser, "07-28-15  05:03PM                    4 1234.bin"},
+		{VMSListParser, "1234.BIN;1                1/3          28-JUL-2015 05:03:04  [GOFTP]  (RWED,RWED,RE,)"},
+		{MVSListParser, "WYNK01 3390   2015/07/28  1    1  FB      80  3120  PS  1234.BIN"},
+		{OS400ListParser, "GOFTP           1234 07/28/15 05:03:04 *STMF      1234.bin"},
+	} {
+		info, err := c.parser.ParseEntry(c.entry, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.ModTime().Location() != time.UTC {
+			t.Errorf("%q: got %s", c.entry, info.ModTime())
+		}
+	}
+}
+
+func TestPrepareLISTCustomParser(t *testing.T) {
+	c := newClient(Config{ListParser: ListParserChain{UnixListParser, VMSListParser}}, []string{"vms"})
+
+	lines := c.prepareLIST(nil, []string{
+		"A_VERY_LONG_FILE_NAME.TXT;1",
+		"                         1/3          28-JUL-2015 05:03:04  [GOFTP]  (RWED,RWED,RE,)",
+	})
+
+	if len(lines) != 1 {
+		t.Fatalf("got %q", lines)
+	}
+
+	info, err := c.parseLISTEntry("vms", lines[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "A_VERY_LONG_FILE_NAME.TXT" {
+		t.Errorf("got %q", info.Name())
+	}
+}
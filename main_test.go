@@ -6,14 +6,14 @@ package goftp
 
 import (
 	"errors"
-	"fmt"
 	"log"
 	"net"
 	"os"
-	"os/exec"
-	"path"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/Infiziert90/goftp/goftptest"
 )
 
 var goftpConfig = Config{
@@ -24,125 +24,93 @@ var goftpConfig = Config{
 // list of addresses for tests to connect to
 var ftpdAddrs []string
 
-var (
-	// used for implicit tls test
-	implicitTLSAddrs = []string{"127.0.0.1:2122", "[::1]:2122"}
-	pureAddrs        = []string{"127.0.0.1:2121", "[::1]:2121"}
-	proAddrs         = []string{"127.0.0.1:2124"}
-)
+// used for implicit tls test
+var implicitTLSAddrs []string
 
 func TestMain(m *testing.M) {
-	pureCloser, err := startPureFTPD(pureAddrs, "ftpd/pure-ftpd")
-	ftpdAddrs = append(ftpdAddrs, pureAddrs...)
+	if err := freshenTestroot(); err != nil {
+		log.Fatal(err)
+	}
 
+	closer, addrs, err := startFTPDs(false)
 	if err != nil {
 		log.Fatal(err)
 	}
+	ftpdAddrs = addrs
 
-	proCloser, err := startProFTPD()
-	// this port is hard coded in its config
-	ftpdAddrs = append(ftpdAddrs, proAddrs...)
-
+	implicitCloser, addrs, err := startFTPDs(true)
 	if err != nil {
 		log.Fatal(err)
 	}
+	implicitTLSAddrs = addrs
 
 	var ret int
 	func() {
-		defer pureCloser()
-		defer proCloser()
+		defer closer()
+		defer implicitCloser()
 		ret = m.Run()
 	}()
 
 	os.Exit(ret)
 }
 
-func startPureFTPD(addrs []string, binary string) (func(), error) {
+// freshenTestroot bumps the mtimes in testroot/ to the present like a fresh
+// checkout would. LIST only includes the time of day for files modified
+// within the last six months, so the LIST parsing tests can't compare
+// older mtimes.
+func freshenTestroot() error {
 	if _, err := os.Open("client_test.go"); os.IsNotExist(err) {
-		return nil, errors.New("must run tests in goftp/ directory")
-	}
-
-	if _, err := os.Stat(binary); os.IsNotExist(err) {
-		return nil, fmt.Errorf("%s not found - you need to run ./build_test_server.sh from the goftp directory", binary)
-	}
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("couldn't determine cwd: %s", err)
+		return errors.New("must run tests in goftp/ directory")
 	}
 
-	var ftpdProcs []*os.Process
-	for _, addr := range addrs {
-		host, port, err := net.SplitHostPort(addr)
+	now := time.Now()
+	return filepath.Walk("testroot", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			panic(err)
-		}
-
-		cmd := exec.Command(binary,
-			"--bind", host+","+port,
-			"--login", "puredb:ftpd/users.pdb",
-			"--tls", "1",
-		)
-
-		cmd.Env = []string{fmt.Sprintf("FTP_ANON_DIR=%s/testroot", cwd)}
-
-		err = cmd.Start()
-		if err != nil {
-			return nil, fmt.Errorf("error starting pure-ftpd on %s: %s", addr, err)
+			return err
 		}
+		return os.Chtimes(path, now, now)
+	})
+}
 
-		ftpdProcs = append(ftpdProcs, cmd.Process)
-	}
+// startFTPDs starts test servers serving testroot/ on the IPv4 and, if
+// available, the IPv6 loopback address.
+func startFTPDs(implicitTLS bool) (func(), []string, error) {
+	var (
+		servers []*goftptest.Server
+		addrs   []string
+	)
 
 	closer := func() {
-		for _, proc := range ftpdProcs {
-			proc.Kill()
+		for _, server := range servers {
+			server.Close()
 		}
 	}
 
-	// give them a bit to get started
-	time.Sleep(100 * time.Millisecond)
-
-	return closer, nil
-}
-
-// ./proftpd --nodaemon --config `pwd`/proftpd.conf
-func startProFTPD() (func(), error) {
-	if _, err := os.Open("client_test.go"); os.IsNotExist(err) {
-		return nil, errors.New("must run tests in goftp/ directory")
-	}
-
-	binary := "ftpd/proftpd"
-
-	if _, err := os.Stat(binary); os.IsNotExist(err) {
-		return nil, fmt.Errorf("%s not found - you need to run ./build_test_server.sh from the goftp directory", binary)
-	}
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("couldn't determine cwd: %s", err)
-	}
-
-	cmd := exec.Command(binary,
-		"--nodaemon",
-		"--config", path.Join(cwd, "ftpd", "proftpd.conf"),
-		// "--debug", "10",
-	)
+	for _, listenAddr := range []string{"127.0.0.1:0", "[::1]:0"} {
+		l, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			if listenAddr == "127.0.0.1:0" {
+				closer()
+				return nil, nil, err
+			}
+			// no IPv6 on this machine
+			continue
+		}
 
-	// cmd.Stdout = os.Stdout
-	// cmd.Stderr = os.Stderr
+		server := goftptest.NewUnstartedServer(goftptest.Dir("testroot"))
+		server.Listener.Close()
+		server.Listener = l
 
-	err = cmd.Start()
-	if err != nil {
-		return nil, fmt.Errorf("error starting proftpd on: %s", err)
-	}
+		if implicitTLS {
+			server.StartTLS()
+		} else {
+			server.Users = map[string]string{"goftp": "rocks"}
+			server.Start()
+		}
 
-	closer := func() {
-		cmd.Process.Kill()
+		servers = append(servers, server)
+		addrs = append(addrs, server.Addr)
 	}
 
-	// give it a bit to get started
-	time.Sleep(100 * time.Millisecond)
-
-	return closer, nil
+	return closer, addrs, nil
 }
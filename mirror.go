@@ -0,0 +1,642 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorOption configures a Download or Upload.
+type MirrorOption func(*mirrorOptions)
+
+type mirrorOptions struct {
+	transfer         []TransferOption
+	deleteExtraneous bool
+}
+
+// WithTransferOptions applies opts, such as WithProgress or
+// WithBandwidthLimit, to every file a Download or Upload transfers.
+func WithTransferOptions(opts ...TransferOption) MirrorOption {
+	return func(o *mirrorOptions) {
+		o.transfer = append(o.transfer, opts...)
+	}
+}
+
+// WithDeleteExtraneous makes Upload delete remote files and directories
+// that don't exist locally, so the remote tree ends up a copy of the local
+// one.
+func WithDeleteExtraneous() MirrorOption {
+	return func(o *mirrorOptions) {
+		o.deleteExtraneous = true
+	}
+}
+
+// MirrorReport summarizes a Download or Upload. Paths are slash-separated
+// and relative to the directories being mirrored, and sorted.
+type MirrorReport struct {
+	// Files transferred, including resumed ones.
+	Copied []string
+
+	// Files that were resumed rather than transferred from the start.
+	Resumed []string
+
+	// Files left alone as their size and ModTime already matched, and
+	// entries that can't be mirrored, such as links to directories.
+	Skipped []string
+
+	// Remote files and directories removed by WithDeleteExtraneous.
+	Deleted []string
+
+	// Files and directories that couldn't be mirrored, with the reason.
+	Failed map[string]error
+
+	// Bytes transferred.
+	Bytes int64
+}
+
+// mirror collects a MirrorReport from concurrent transfers.
+type mirror struct {
+	mu     sync.Mutex
+	report MirrorReport
+}
+
+func (m *mirror) copied(rel string, n int64, resumed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.report.Copied = append(m.report.Copied, rel)
+	if resumed {
+		m.report.Resumed = append(m.report.Resumed, rel)
+	}
+	m.report.Bytes += n
+}
+
+func (m *mirror) skipped(rel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.report.Skipped = append(m.report.Skipped, rel)
+}
+
+func (m *mirror) deleted(rel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.report.Deleted = append(m.report.Deleted, rel)
+}
+
+func (m *mirror) failed(rel string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.report.Failed == nil {
+		m.report.Failed = make(map[string]error)
+	}
+	m.report.Failed[rel] = err
+}
+
+// finish sorts the report and sums up its failures, if any, as an error.
+func (m *mirror) finish(ctx context.Context, op string) (*MirrorReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := &m.report
+	sort.Strings(r.Copied)
+	sort.Strings(r.Resumed)
+	sort.Strings(r.Skipped)
+	sort.Strings(r.Deleted)
+
+	if ctx.Err() != nil {
+		return r, contextError(ctx)
+	}
+
+	if len(r.Failed) == 0 {
+		return r, nil
+	}
+
+	failed := make([]string, 0, len(r.Failed))
+	for rel := range r.Failed {
+		failed = append(failed, rel)
+	}
+	sort.Strings(failed)
+
+	return r, ftpError{err: fmt.Errorf("%s failed for %d entries, first %q: %w", op, len(failed), failed[0], r.Failed[failed[0]])}
+}
+
+// relPath returns p, found by walking root, relative to root: "" for root
+// itself, and a path starting with ".." if the names the server listed lead
+// out of root.
+func relPath(root, p string) string {
+	root, p = path.Clean(root), path.Clean(p)
+	switch {
+	case p == root:
+		return ""
+	case root == ".":
+		return p
+	case root == "/" && path.IsAbs(p):
+		return p[1:]
+	case strings.HasPrefix(p, root+"/"):
+		return p[len(root)+1:]
+	default:
+		return path.Join("..", p)
+	}
+}
+
+// localPath returns where the remote entry rel goes in localDir, failing
+// if rel, made of names the server listed, doesn't lead into localDir.
+func localPath(localDir, rel string) (string, error) {
+	local := filepath.Join(localDir, filepath.FromSlash(rel))
+
+	inside, err := filepath.Rel(localDir, local)
+	if err != nil || rel == "" || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") ||
+		inside == "." || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", ftpError{err: fmt.Errorf("%q leads out of %s", rel, localDir)}
+	}
+
+	return local, nil
+}
+
+// parentRel returns the directory of rel, "" for entries at the top.
+func parentRel(rel string) string {
+	if dir := path.Dir(rel); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile reports whether local is likely a copy of remote, as their sizes
+// match and so do their ModTimes, to the precision of the listing.
+func sameFile(local, remote os.FileInfo) bool {
+	if local.Size() != remote.Size() || remote.ModTime().IsZero() {
+		return false
+	}
+
+	return local.ModTime().Truncate(time.Second).Equal(remote.ModTime().Truncate(time.Second))
+}
+
+// Download mirrors the remote directory remoteDir into the local directory
+// localDir, creating it and any subdirectories as needed. The remote tree is
+// listed as with Walk, and files are then retrieved concurrently on up to
+// ConnectionsPerHost connections.
+//
+// Files whose local copy has the same size and ModTime are skipped. Local
+// files that are smaller and newer than their remote counterpart are taken
+// to be interrupted downloads and resumed with "REST" if the server supports
+// it (and no hash is to be verified). Downloaded files and directories get
+// the remote ModTime. Symbolic links to files are downloaded as regular
+// files; links to directories are skipped. Entries whose names would lead
+// out of localDir fail.
+//
+// Failing files don't stop the download. They are listed in the report, and
+// the returned error sums them up.
+func (c *Client) Download(remoteDir, localDir string, opts ...MirrorOption) (*MirrorReport, error) {
+	return c.DownloadContext(context.Background(), remoteDir, localDir, opts...)
+}
+
+// DownloadContext is like Download, but gives up as soon as ctx is done.
+func (c *Client) DownloadContext(ctx context.Context, remoteDir, localDir string, opts ...MirrorOption) (*MirrorReport, error) {
+	var o mirrorOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// once for all files, so they share a bandwidth limit
+	topts := c.transferOptions(o.transfer)
+
+	m := &mirror{}
+
+	type download struct {
+		rel  string
+		info os.FileInfo
+	}
+
+	var (
+		files []download
+		dirs  []download
+	)
+
+	// Walk reports root first, and a second time if it can't be listed.
+	// Entries can't be told apart from root by their path, as a hostile
+	// server may list one named ".".
+	var calls int
+	err := c.WalkContext(ctx, remoteDir, func(p string, info os.FileInfo, err error) error {
+		calls++
+		if calls == 1 || calls == 2 && err != nil {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() {
+				return ftpError{err: fmt.Errorf("%s is not a directory", remoteDir)}
+			}
+
+			if err := os.MkdirAll(localDir, 0755); err != nil {
+				return ftpError{err: err}
+			}
+			dirs = append(dirs, download{"", info})
+			return nil
+		}
+
+		rel := relPath(remoteDir, p)
+
+		local, pathErr := localPath(localDir, rel)
+		if pathErr != nil {
+			if rel == "" {
+				rel = "."
+			}
+			m.failed(rel, pathErr)
+			if err == nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err != nil {
+			m.failed(rel, err)
+			return nil
+		}
+
+		if info.IsDir() {
+			if err := os.MkdirAll(local, 0755); err != nil {
+				m.failed(rel, err)
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, download{rel, info})
+			return nil
+		}
+
+		files = append(files, download{rel, info})
+		return nil
+	})
+	if err != nil {
+		r, _ := m.finish(ctx, "download")
+		return r, err
+	}
+
+	jobs := make(chan download)
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.ConnectionsPerHost; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				c.downloadFile(ctx, m, path.Join(remoteDir, f.rel), localDir, f.rel, f.info, topts)
+			}
+		}()
+	}
+
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	// writing files changed the directories' ModTimes, so set them last,
+	// deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		mtime := dirs[i].info.ModTime()
+		if mtime.IsZero() {
+			continue
+		}
+		local := filepath.Join(localDir, filepath.FromSlash(dirs[i].rel))
+		if err := os.Chtimes(local, mtime, mtime); err != nil {
+			c.debug("error setting ModTime of %s: %s", local, err)
+		}
+	}
+
+	return m.finish(ctx, "download")
+}
+
+// downloadFile mirrors the remote file of info to rel in localDir.
+func (c *Client) downloadFile(ctx context.Context, m *mirror, remote, localDir, rel string, info os.FileInfo, topts transferOptions) {
+	if info.Mode()&os.ModeSymlink != 0 {
+		followed, err := c.StatContext(ctx, remote)
+		if err != nil {
+			m.failed(rel, err)
+			return
+		}
+
+		if !followed.Mode().IsRegular() {
+			m.skipped(rel)
+			return
+		}
+		info = followed
+	} else if !info.Mode().IsRegular() {
+		m.skipped(rel)
+		return
+	}
+
+	local := filepath.Join(localDir, filepath.FromSlash(rel))
+
+	var offset int64
+	if existing, err := os.Stat(local); err == nil {
+		if sameFile(existing, info) {
+			m.skipped(rel)
+			return
+		}
+
+		if existing.Size() < info.Size() && existing.ModTime().After(info.ModTime()) &&
+			topts.verifyHash == "" && c.canResume(ctx) {
+			offset = existing.Size()
+		}
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(local, flag, 0644)
+	if err != nil {
+		m.failed(rel, err)
+		return
+	}
+
+	counter := &countingWriter{w: f}
+	err = c.retrieveFrom(ctx, remote, counter, offset, topts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		m.failed(rel, err)
+		return
+	}
+
+	if mtime := info.ModTime(); !mtime.IsZero() {
+		if err := os.Chtimes(local, mtime, mtime); err != nil {
+			m.failed(rel, err)
+			return
+		}
+	}
+
+	m.copied(rel, counter.n, offset > 0)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Upload mirrors the local directory localDir to the remote directory
+// remoteDir, creating it and any subdirectories as needed. The remote tree
+// is listed as with Walk to find out what changed, and files are then stored
+// concurrently on up to ConnectionsPerHost connections. Missing directories
+// are created as with MkdirAll.
+//
+// Files are skipped if the remote copy has the same size and a ModTime no
+// older than the local file's. Uploaded files get the local ModTime if the
+// server supports setting it (see Chtimes). Symbolic links to files are
+// uploaded as regular files; links to directories are skipped. With
+// WithDeleteExtraneous, remote entries missing locally are deleted.
+//
+// Failing files don't stop the upload. They are listed in the report, and
+// the returned error sums them up.
+func (c *Client) Upload(localDir, remoteDir string, opts ...MirrorOption) (*MirrorReport, error) {
+	return c.UploadContext(context.Background(), localDir, remoteDir, opts...)
+}
+
+// UploadContext is like Upload, but gives up as soon as ctx is done.
+func (c *Client) UploadContext(ctx context.Context, localDir, remoteDir string, opts ...MirrorOption) (*MirrorReport, error) {
+	var o mirrorOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// once for all files, so they share a bandwidth limit
+	topts := c.transferOptions(o.transfer)
+
+	m := &mirror{}
+
+	type upload struct {
+		rel  string
+		info os.FileInfo
+	}
+
+	var (
+		dirs  []string
+		files []upload
+		local = make(map[string]bool)
+
+		// prefixes of local directories that couldn't be read
+		unreadable []string
+	)
+
+	err := filepath.Walk(localDir, func(p string, info os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(localDir, p)
+		if relErr != nil {
+			return relErr
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+
+		if err != nil {
+			if rel == "" {
+				return err
+			}
+			// keep what's in the way on the server
+			local[rel] = true
+			unreadable = append(unreadable, rel+"/")
+			m.failed(rel, err)
+			return nil
+		}
+
+		if rel == "" && !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", localDir)
+		}
+
+		local[rel] = true
+
+		if info.IsDir() {
+			dirs = append(dirs, rel)
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = os.Stat(p)
+			if err != nil {
+				m.failed(rel, err)
+				return nil
+			}
+		}
+
+		if !info.Mode().IsRegular() {
+			m.skipped(rel)
+			return nil
+		}
+
+		files = append(files, upload{rel, info})
+		return nil
+	})
+	if err != nil {
+		r, _ := m.finish(ctx, "upload")
+		return r, ftpError{err: err}
+	}
+
+	// what's there already, keyed by path relative to remoteDir
+	remote := make(map[string]os.FileInfo)
+	err = c.WalkContext(ctx, remoteDir, func(p string, info os.FileInfo, err error) error {
+		rel := relPath(remoteDir, p)
+
+		if err != nil {
+			if rel != "" {
+				m.failed(rel, err)
+				return nil
+			} else if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		remote[rel] = info
+		return nil
+	})
+	if err != nil {
+		r, _ := m.finish(ctx, "upload")
+		return r, err
+	}
+
+	if info, ok := remote[""]; ok && !info.IsDir() {
+		r, _ := m.finish(ctx, "upload")
+		return r, ftpError{err: fmt.Errorf("%s is not a directory", remoteDir)}
+	}
+
+	known := make(map[string]bool)
+	for rel, info := range remote {
+		if info.IsDir() {
+			known[path.Join(remoteDir, rel)] = true
+		}
+	}
+
+	// parents come before their children
+	failedDirs := make(map[string]bool)
+	for _, rel := range dirs {
+		if rel != "" && failedDirs[parentRel(rel)] {
+			failedDirs[rel] = true
+			continue
+		}
+
+		if err := c.mkdirAll(ctx, path.Join(remoteDir, rel), known); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			failedDirs[rel] = true
+			m.failed(rel, err)
+		}
+	}
+
+	jobs := make(chan upload)
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.ConnectionsPerHost; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				c.uploadFile(ctx, m, filepath.Join(localDir, filepath.FromSlash(f.rel)), path.Join(remoteDir, f.rel), f.rel, f.info, remote[f.rel], topts)
+			}
+		}()
+	}
+
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		if failedDirs[parentRel(f.rel)] {
+			continue
+		}
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	if o.deleteExtraneous && ctx.Err() == nil {
+		var extraneous []string
+		for rel := range remote {
+			if !local[rel] && !hasAnyPrefix(rel, unreadable) {
+				extraneous = append(extraneous, rel)
+			}
+		}
+
+		c.deleteExtraneous(ctx, m, remoteDir, extraneous, remote)
+	}
+
+	return m.finish(ctx, "upload")
+}
+
+// uploadFile mirrors the local file of info to remote, whose current state
+// is existing (nil if it doesn't exist).
+func (c *Client) uploadFile(ctx context.Context, m *mirror, local, remote, rel string, info, existing os.FileInfo, topts transferOptions) {
+	if existing != nil && existing.Size() == info.Size() &&
+		!existing.ModTime().Truncate(time.Second).Before(info.ModTime().Truncate(time.Second)) {
+		m.skipped(rel)
+		return
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		m.failed(rel, err)
+		return
+	}
+	defer f.Close()
+
+	if err := c.store(ctx, remote, f, topts); err != nil {
+		m.failed(rel, err)
+		return
+	}
+
+	if err := c.ChtimesContext(ctx, remote, info.ModTime()); err != nil {
+		c.debug("error setting ModTime of %s: %s", remote, err)
+	}
+
+	m.copied(rel, info.Size(), false)
+}
+
+// deleteExtraneous deletes the remote entries rels (relative to remoteDir)
+// described by remote, see removeEntries.
+func (c *Client) deleteExtraneous(ctx context.Context, m *mirror, remoteDir string, rels []string, remote map[string]os.FileInfo) {
+	var files, dirs []string
+	for _, rel := range rels {
+		if remote[rel].IsDir() {
+			dirs = append(dirs, path.Join(remoteDir, rel))
+		} else {
+			files = append(files, path.Join(remoteDir, rel))
+		}
+	}
+
+	c.removeEntries(ctx, files, dirs, func(p string, err error) {
+		if rel := relPath(remoteDir, p); err != nil {
+			m.failed(rel, err)
+		} else {
+			m.deleted(rel)
+		}
+	})
+}
@@ -0,0 +1,497 @@
+package goftp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func mirrorTestFS(t *testing.T, mtime time.Time) *goftptest.MemFS {
+	fs := goftptest.NewMemFS()
+
+	files := map[string][]byte{
+		"a.txt":              []byte("lorem"),
+		"sub/b.txt":          []byte("ipsum dolor"),
+		"sub/deeper/c.bin":   bytes.Repeat([]byte{1, 2, 3, 4}, 100000),
+		"empty/.placeholder": nil,
+	}
+	for name, data := range files {
+		if err := fs.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Remove("/empty/.placeholder"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/deeper/c.bin", "sub/deeper", "sub", "empty"} {
+		if err := fs.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fs
+}
+
+func TestDownload(t *testing.T) {
+	mtime := time.Date(2015, 7, 28, 5, 3, 4, 0, time.UTC)
+	fs := mirrorTestFS(t, mtime)
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	local, err := ioutil.TempDir("", "goftp-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	report, err := c.Download("/", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []string{"a.txt", "sub/b.txt", "sub/deeper/c.bin"}; !reflect.DeepEqual(report.Copied, exp) {
+		t.Errorf("got %v", report.Copied)
+	}
+
+	if report.Bytes != 5+11+400000 {
+		t.Errorf("got %d bytes", report.Bytes)
+	}
+
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/deeper/c.bin", "sub", "empty"} {
+		info, err := os.Stat(filepath.Join(local, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: got %s", name, info.ModTime())
+		}
+	}
+
+	// everything is up to date
+	report, err = c.Download("", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Copied) != 0 || len(report.Skipped) != 3 {
+		t.Errorf("got %+v", report)
+	}
+
+	// an interrupted download is resumed, a changed file downloaded again
+	partial := filepath.Join(local, "sub", "deeper", "c.bin")
+	if err := os.Truncate(partial, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.WriteFile("a.txt", []byte("LOREM"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = c.Download("/", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(report.Copied, []string{"a.txt", "sub/deeper/c.bin"}) ||
+		!reflect.DeepEqual(report.Resumed, []string{"sub/deeper/c.bin"}) || report.Bytes != 5+399000 {
+		t.Errorf("got %+v", report)
+	}
+
+	got, err := ioutil.ReadFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, bytes.Repeat([]byte{1, 2, 3, 4}, 100000)) {
+		t.Error("resumed file differs")
+	}
+
+	if got, _ := ioutil.ReadFile(filepath.Join(local, "a.txt")); string(got) != "LOREM" {
+		t.Errorf("got %q", got)
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+func TestDownloadErrors(t *testing.T) {
+	fs := mirrorTestFS(t, time.Date(2015, 7, 28, 5, 3, 4, 0, time.UTC))
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	local, err := ioutil.TempDir("", "goftp-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	// a directory is in the way of sub/b.txt
+	if err := os.MkdirAll(filepath.Join(local, "b", "b.txt"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.Download("sub", filepath.Join(local, "b"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if !reflect.DeepEqual(report.Copied, []string{"deeper/c.bin"}) || len(report.Failed) != 1 || report.Failed["b.txt"] == nil {
+		t.Errorf("got %+v", report)
+	}
+
+	if _, err := c.Download("a.txt", filepath.Join(local, "a")); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := c.Download("missing", filepath.Join(local, "missing")); err == nil {
+		t.Error("expected error")
+	}
+
+	// localDir can't be created under a file
+	if err := ioutil.WriteFile(filepath.Join(local, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []string{"", "/"} {
+		report, err := c.Download(root, filepath.Join(local, "file", "x"))
+		if _, ok := err.(Error); !ok {
+			t.Errorf("%q: got %v", root, err)
+		}
+
+		if len(report.Failed) != 0 {
+			t.Errorf("%q: got %+v", root, report)
+		}
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+// hostileFS lists a directory named ".." in every directory.
+type hostileFS struct {
+	*goftptest.MemFS
+}
+
+func (fs hostileFS) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := fs.MemFS.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := fs.MemFS.Stat("/")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(infos, namedFileInfo{parent, ".."}), nil
+}
+
+func TestDownloadOutsideLocalDir(t *testing.T) {
+	memFS := goftptest.NewMemFS()
+	for _, name := range []string{"secret", "sub/a.txt"} {
+		if err := memFS.WriteFile(name, []byte("lorem"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := goftptest.NewServer(hostileFS{memFS})
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tmp, err := ioutil.TempDir("", "goftp-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, root := range []string{"", "sub"} {
+		local := filepath.Join(tmp, "local", "dst")
+
+		// Walk leaves out the ".." entries
+		report, err := c.Download(root, local)
+		if err != nil {
+			t.Errorf("%q: %s", root, err)
+		}
+
+		exp := map[string][]string{"": {"secret", "sub/a.txt"}, "sub": {"a.txt"}}[root]
+		if !reflect.DeepEqual(report.Copied, exp) {
+			t.Errorf("%q: got %+v", root, report)
+		}
+
+		// nothing but dst in local
+		if infos, err := ioutil.ReadDir(filepath.Dir(local)); err != nil || len(infos) != 1 {
+			t.Errorf("%q: got %v %v", root, infos, err)
+		}
+
+		if err := os.RemoveAll(filepath.Dir(local)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+func TestRelPath(t *testing.T) {
+	for _, c := range []struct{ root, p, exp string }{
+		{"", "", ""},
+		{"", "a/b", "a/b"},
+		{".", ".", ""},
+		{"/", "/", ""},
+		{"/", "/a/b", "a/b"},
+		{"dir", "dir", ""},
+		{"dir/", "dir/a", "a"},
+		{"/dir", "/dir/a/b", "a/b"},
+		{"", "..", ".."},
+		{"dir", ".", ".."},
+		{"dir", "other/a", "../other/a"},
+	} {
+		if got := relPath(c.root, c.p); got != c.exp {
+			t.Errorf("relPath(%q, %q): got %q", c.root, c.p, got)
+		}
+	}
+}
+
+func TestUpload(t *testing.T) {
+	local, err := ioutil.TempDir("", "goftp-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	mtime := time.Date(2015, 7, 28, 5, 3, 4, 0, time.UTC)
+	files := map[string][]byte{
+		"a.txt":            []byte("lorem"),
+		"sub/b.txt":        []byte("ipsum dolor"),
+		"sub/deeper/c.bin": bytes.Repeat([]byte{1, 2, 3, 4}, 100000),
+	}
+	for name, data := range files {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(local, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := goftptest.NewMemFS()
+	if err := fs.MkdirAll("site", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(fs)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	report, err := c.Upload(local, "site/www")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []string{"a.txt", "sub/b.txt", "sub/deeper/c.bin"}; !reflect.DeepEqual(report.Copied, exp) {
+		t.Errorf("got %v", report.Copied)
+	}
+
+	if report.Bytes != 5+11+400000 {
+		t.Errorf("got %d bytes", report.Bytes)
+	}
+
+	for name, data := range files {
+		buf := new(bytes.Buffer)
+		if err := c.Retrieve("site/www/"+name, buf); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("%s differs", name)
+		}
+
+		info, err := fs.Stat("/site/www/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: got %s", name, info.ModTime())
+		}
+	}
+
+	if info, err := fs.Stat("/site/www/empty"); err != nil || !info.IsDir() {
+		t.Errorf("got %v %v", info, err)
+	}
+
+	// only what changed is uploaded again
+	if err := ioutil.WriteFile(filepath.Join(local, "a.txt"), []byte("LOREM"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"site/www/old.txt", "site/www/olddir/x.txt", "site/www/olddir/y/z"} {
+		if err := fs.WriteFile(name, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err = c.Upload(local, "site/www")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(report.Copied, []string{"a.txt"}) || len(report.Skipped) != 2 || len(report.Deleted) != 0 {
+		t.Errorf("got %+v", report)
+	}
+
+	// unless told to, nothing is deleted
+	if _, err := fs.Stat("/site/www/old.txt"); err != nil {
+		t.Error(err)
+	}
+
+	report, err = c.Upload(local, "site/www", WithDeleteExtraneous())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{"old.txt", "olddir", "olddir/x.txt", "olddir/y", "olddir/y/z"}
+	if len(report.Copied) != 0 || !reflect.DeepEqual(report.Deleted, exp) {
+		t.Errorf("got %+v", report)
+	}
+
+	list, err := c.ReadDir("site/www")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, info := range list {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+
+	if !reflect.DeepEqual(names, []string{"a.txt", "empty", "sub"}) {
+		t.Errorf("got %v", names)
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+func TestUploadRoot(t *testing.T) {
+	local, err := ioutil.TempDir("", "goftp-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte("lorem"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, root := range []string{"", "/"} {
+		fs := goftptest.NewMemFS()
+		for _, name := range []string{"old.txt", "olddir/x"} {
+			if err := fs.WriteFile(name, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		server := goftptest.NewServer(fs)
+		defer server.Close()
+
+		c, err := Dial(server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		report, err := c.Upload(local, root, WithDeleteExtraneous())
+		if err != nil {
+			t.Fatalf("%q: %s", root, err)
+		}
+
+		if !reflect.DeepEqual(report.Copied, []string{"a.txt", "sub/b.txt"}) ||
+			!reflect.DeepEqual(report.Deleted, []string{"old.txt", "olddir", "olddir/x"}) {
+			t.Errorf("%q: got %+v", root, report)
+		}
+
+		list, err := fs.ReadDir("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, info := range list {
+			names = append(names, info.Name())
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(names, []string{"a.txt", "sub"}) {
+			t.Errorf("%q: got %v", root, names)
+		}
+
+		// local errors are Errors too
+		if _, err := c.Upload(filepath.Join(local, "a.txt"), root); err == nil {
+			t.Errorf("%q: expected error", root)
+		} else if _, ok := err.(Error); !ok {
+			t.Errorf("%q: got %T", root, err)
+		}
+
+		if _, err := c.Upload(filepath.Join(local, "missing"), root); err == nil {
+			t.Errorf("%q: expected error", root)
+		} else if _, ok := err.(Error); !ok {
+			t.Errorf("%q: got %T", root, err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+)
+
+// MkdirAll creates directory "path" along with any missing parents, like
+// os.MkdirAll, and returns nil if it exists already. Which directories
+// exist is found out with Stat, or "CWD" where "LIST" can't tell, so that
+// an "MKD" failing for lack of permission isn't mistaken for the directory
+// existing.
+func (c *Client) MkdirAll(path string) error {
+	return c.MkdirAllContext(context.Background(), path)
+}
+
+// MkdirAllContext is like MkdirAll, but gives up as soon as ctx is done.
+func (c *Client) MkdirAllContext(ctx context.Context, path string) error {
+	return c.mkdirAll(ctx, path, make(map[string]bool))
+}
+
+// mkdirAll is MkdirAll, remembering the directories known to exist in
+// known to spare further calls probing them again.
+func (c *Client) mkdirAll(ctx context.Context, name string, known map[string]bool) error {
+	name = path.Clean(name)
+	if name == "." || name == "/" || known[name] {
+		return nil
+	}
+
+	exists, err := c.dirExists(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		if err := c.mkdirAll(ctx, path.Dir(name), known); err != nil {
+			return err
+		}
+
+		if _, err := c.MkdirContext(ctx, name); err != nil {
+			// someone else may have been quicker
+			if exists, probeErr := c.dirExists(ctx, name); probeErr != nil || !exists {
+				return err
+			}
+		}
+	}
+
+	known[name] = true
+
+	return nil
+}
+
+// dirExists reports whether directory name exists, failing if name is
+// something else.
+func (c *Client) dirExists(ctx context.Context, name string) (bool, error) {
+	info, err := c.StatContext(ctx, name)
+	if err == nil && info.IsDir() {
+		return true, nil
+	}
+
+	if ctx.Err() != nil {
+		return false, contextError(ctx)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	// "LIST" can't describe directories, it lists their contents instead
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	isDir, err := pconn.isDir(name)
+	c.returnConn(pconn)
+	if err != nil {
+		return false, err
+	}
+
+	if !isDir && info != nil && info.Name() == path.Base(name) {
+		return false, ftpError{err: &fs.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}}
+	}
+
+	return isDir, nil
+}
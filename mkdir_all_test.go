@@ -0,0 +1,61 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func TestMkdirAll(t *testing.T) {
+	for _, disabled := range [][]string{nil, {"MLST"}} {
+		memFS := goftptest.NewMemFS()
+		if err := memFS.WriteFile("subdir/file", nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		server := goftptest.NewServer(memFS)
+		server.Disabled = disabled
+		defer server.Close()
+
+		c, err := Dial(server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		for _, name := range []string{"subdir", "a/b/c", "/subdir/d/e", "a/b"} {
+			if err := c.MkdirAll(name); err != nil {
+				t.Errorf("%v %s: %s", disabled, name, err)
+			}
+
+			if info, err := memFS.Stat("/" + name); err != nil || !info.IsDir() {
+				t.Errorf("%v %s: got %v", disabled, name, err)
+			}
+		}
+
+		for _, name := range []string{"subdir/file", "subdir/file/x"} {
+			if err := c.MkdirAll(name); err == nil {
+				t.Errorf("%v %s: expected error", disabled, name)
+			} else if _, ok := err.(Error); !ok {
+				t.Errorf("%v %s: got %T", disabled, name, err)
+			}
+		}
+
+		// directories known to exist aren't looked at again
+		known := map[string]bool{"ghost": true}
+		if err := c.mkdirAll(context.Background(), "ghost/", known); err != nil {
+			t.Error(err)
+		}
+
+		if _, err := memFS.Stat("/ghost"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got %v", err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
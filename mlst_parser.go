@@ -11,6 +11,51 @@ import (
 
 type mlstParser struct{}
 
+// MLSTFacts holds the facts of an "MLST"/"MLSD" entry (see RFC 3659). It is
+// what the Sys method of os.FileInfo's parsed from such entries returns.
+// Facts the server didn't send are left empty, UnixUID and UnixGID are -1.
+type MLSTFacts struct {
+	// Type is the "type" fact as sent, e.g. "file", "dir" or
+	// "OS.unix=slink:/path/to/target".
+	Type string
+
+	// Unique identifies the file on the server, so hard links and files
+	// reachable through several paths can be recognized.
+	Unique string
+
+	// Perm lists what you may do with the file, e.g. "adfrw".
+	Perm string
+
+	// Create is the file's creation time.
+	Create time.Time
+
+	// Lang, MediaType and Charset describe the file's content.
+	Lang      string
+	MediaType string
+	Charset   string
+
+	// UnixOwner and UnixGroup are the file's owner and group, by name or
+	// number depending on the server.
+	UnixOwner string
+	UnixGroup string
+
+	// UnixUID and UnixGID are the file's numeric owner and group.
+	UnixUID int
+	UnixGID int
+
+	// Other holds facts not listed above and not otherwise reflected in the
+	// os.FileInfo, such as vendor extensions, keyed by lower case fact name.
+	Other map[string]string
+
+	// Raw is the entry as sent by the server.
+	Raw string
+}
+
+// String returns the raw entry.
+func (f *MLSTFacts) String() string {
+	return f.Raw
+}
+
 type mlstToken int
 
 type mlstFacts struct {
@@ -32,10 +77,19 @@ func parseMLST(entry string, skipSelfParent bool) (os.FileInfo, error) {
 	return mlstParser{}.parse(entry, skipSelfParent)
 }
 
+// ParseMLSTEntry parses a single "MLST"/"MLSD" entry, such as a line of a
+// saved MLSD listing, the way ReadDir does. The os.FileInfo's Sys method
+// returns the entry's *MLSTFacts. Entries for the listed directory itself
+// and its parent (types "cdir" and "pdir") are returned too.
+func ParseMLSTEntry(entry string) (os.FileInfo, error) {
+	return parseMLST(entry, false)
+}
+
 // an entry looks something like this:
 // type=file;size=12;modify=20150216084148;UNIX.mode=0644;unique=1000004g1187ec7; lorem.txt
 func (p mlstParser) parse(entry string, skipSelfParent bool) (os.FileInfo, error) {
 	var facts mlstFacts
+	sys := &MLSTFacts{UnixUID: -1, UnixGID: -1, Raw: entry}
 	state := mlstFactName
 	var left string // Previous token.
 	var i1 int      // Current token's start position.
@@ -48,21 +102,54 @@ func (p mlstParser) parse(entry string, skipSelfParent bool) (os.FileInfo, error
 				}
 				var (
 					key = strings.ToLower(left[:len(left)-1])
-					val = strings.ToLower(entry[i1:i2])
+					raw = entry[i1:i2]
+					val = strings.ToLower(raw)
 				)
 				switch key {
 				case "type":
 					facts.typ = val
+					sys.Type = raw
 				case "unix.mode":
 					facts.unixMode = val
 				case "perm":
 					facts.perm = val
+					sys.Perm = raw
 				case "size":
 					facts.size = val
 				case "sizd":
 					facts.sizd = val
 				case "modify":
 					facts.modify = val
+				case "unique":
+					sys.Unique = raw
+				case "create":
+					// fractions of seconds are allowed, but rarely useful
+					if t, ok := p.parseModTime(strings.SplitN(raw, ".", 2)[0]); ok {
+						sys.Create = t
+					}
+				case "lang":
+					sys.Lang = raw
+				case "media-type":
+					sys.MediaType = raw
+				case "charset":
+					sys.Charset = raw
+				case "unix.owner":
+					sys.UnixOwner = raw
+				case "unix.group":
+					sys.UnixGroup = raw
+				case "unix.uid":
+					if uid, err := strconv.Atoi(raw); err == nil {
+						sys.UnixUID = uid
+					}
+				case "unix.gid":
+					if gid, err := strconv.Atoi(raw); err == nil {
+						sys.UnixGID = gid
+					}
+				default:
+					if sys.Other == nil {
+						sys.Other = make(map[string]string)
+					}
+					sys.Other[key] = raw
 				}
 				if len(entry) >= i2+1 && entry[i2+1] == ' ' {
 					state = mlstFilename
@@ -101,7 +188,7 @@ func (p mlstParser) parse(entry string, skipSelfParent bool) (os.FileInfo, error
 		if err != nil {
 			return nil, p.error(entry)
 		}
-		mode = os.FileMode(m)
+		mode = fileMode(uint32(m))
 	} else if facts.perm != "" {
 		// see http://tools.ietf.org/html/rfc3659#section-7.5.5
 		for _, c := range facts.perm {
@@ -122,11 +209,15 @@ func (p mlstParser) parse(entry string, skipSelfParent bool) (os.FileInfo, error
 		mode = 0400
 	}
 
+	var link string
 	if typ == "dir" || typ == "cdir" || typ == "pdir" {
 		mode |= os.ModeDir
 	} else if strings.HasPrefix(typ, "os.unix=slink") || strings.HasPrefix(typ, "os.unix=symlink") {
-		// note: there is no general way to determine whether a symlink points to a dir or a file
+		// whether the link points to a dir or a file is up to Stat to find out
 		mode |= os.ModeSymlink
+		if strings.HasPrefix(typ, "os.unix=slink:") {
+			link = sys.Type[len("os.unix=slink:"):]
+		}
 	}
 
 	var (
@@ -161,6 +252,8 @@ func (p mlstParser) parse(entry string, skipSelfParent bool) (os.FileInfo, error
 		mtime: mtime,
 		raw:   entry,
 		mode:  mode,
+		link:  link,
+		sys:   sys,
 	}
 
 	return info, nil
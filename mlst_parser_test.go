@@ -4,6 +4,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var mlstCases = []string{
@@ -88,6 +89,16 @@ func TestParseMLST(t *testing.T) {
 				size:  6,
 			},
 		},
+		{
+			// setuid, setgid and sticky bits
+			"modify=20150928140340;perm=adfrw;size=6;type=file;UNIX.mode=7755; suid",
+			&ftpFile{
+				name:  "suid",
+				mtime: mustParseTime(timeFormat, "20150928140340"),
+				mode:  os.FileMode(0755) | os.ModeSetuid | os.ModeSetgid | os.ModeSticky,
+				size:  6,
+			},
+		},
 	}
 
 	var parser mlstParser
@@ -99,12 +110,83 @@ func TestParseMLST(t *testing.T) {
 			t.Fatal(err)
 		}
 		gotFile := got.(*ftpFile)
+		if gotFile.sys == nil || gotFile.sys.Raw != c.raw {
+			t.Errorf("got facts %+v", gotFile.sys)
+		}
+		gotFile.sys = nil // see TestParseMLSTFacts
 		if !reflect.DeepEqual(gotFile, c.exp) {
 			t.Errorf("exp %+v\n got %+v", c.exp, gotFile)
 		}
 	}
 }
 
+func TestParseMLSTFacts(t *testing.T) {
+	raw := "type=OS.unix=slink:/Target;size=6;modify=20150928140340;create=20150927101112.123;perm=adfrw;" +
+		"unique=801U5AA227;lang=en;media-type=text/plain;charset=UTF-8;UNIX.mode=0777;" +
+		"UNIX.owner=goftp;UNIX.group=staff;UNIX.uid=1000;UNIX.gid=20;X.Vendor=Yes; slinkdir"
+
+	info, err := parseMLST(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &MLSTFacts{
+		Type:      "OS.unix=slink:/Target",
+		Unique:    "801U5AA227",
+		Perm:      "adfrw",
+		Create:    time.Date(2015, 9, 27, 10, 11, 12, 0, time.UTC),
+		Lang:      "en",
+		MediaType: "text/plain",
+		Charset:   "UTF-8",
+		UnixOwner: "goftp",
+		UnixGroup: "staff",
+		UnixUID:   1000,
+		UnixGID:   20,
+		Other:     map[string]string{"x.vendor": "Yes"},
+		Raw:       raw,
+	}
+
+	if got := info.Sys(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("exp %+v\n got %+v", exp, got)
+	}
+
+	info, err = parseMLST("type=file;size=6;modify=20150928140340; minimal", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facts := info.Sys().(*MLSTFacts)
+	if facts.UnixUID != -1 || facts.UnixGID != -1 || facts.Other != nil || !facts.Create.IsZero() {
+		t.Errorf("got %+v", facts)
+	}
+}
+
+func TestParseMLSTEntry(t *testing.T) {
+	info, err := ParseMLSTEntry(mlstCases[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facts, ok := info.Sys().(*MLSTFacts)
+	if !ok || info.Name() != "408.php" || info.Size() != 399 || facts.Unique != "FD00U29043978" {
+		t.Errorf("got %+v (%+v)", info, info.Sys())
+	}
+
+	// unlike in ReadDir, the directory itself isn't skipped
+	info, err = ParseMLSTEntry(mlstCases[7])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name() != "." || !info.IsDir() {
+		t.Errorf("got %+v", info)
+	}
+
+	if _, err := ParseMLSTEntry("garbage"); err == nil {
+		t.Error("expected error")
+	}
+}
+
 func BenchmarkParseMLST(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, c := range mlstCases {
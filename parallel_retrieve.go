@@ -0,0 +1,184 @@
+package goftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RetrieveParallel retrieves file "path" from the server like Retrieve, but
+// splits it into "segments" byte ranges that are downloaded concurrently,
+// each on its own pooled connection, and written to "dest" at their offsets.
+// dest must support concurrent calls to WriteAt for distinct ranges, as
+// *os.File does. Concurrency is bounded by the size of the connection pool
+// (ConnectionsPerHost times the number of hosts), so there is little point
+// in asking for more segments than that.
+//
+// A failed segment is resumed or retried on its own while the others carry
+// on. Only a segment failing several attempts in a row without retrieving
+// any bytes fails the whole download. Once all segments are done,
+// RetrieveParallel verifies the total number of bytes against the file's
+// size.
+//
+// Ranged downloads need the SIZE command and "REST STREAM". If the server
+// doesn't support them (or the file is empty), RetrieveParallel falls back
+// to a plain Retrieve.
+func (c *Client) RetrieveParallel(path string, dest io.WriterAt, segments int) error {
+	return c.RetrieveParallelContext(context.Background(), path, dest, segments)
+}
+
+// RetrieveParallelContext is like RetrieveParallel, but gives up as soon as
+// ctx is done, aborting the transfers in progress.
+func (c *Client) RetrieveParallelContext(ctx context.Context, path string, dest io.WriterAt, segments int) error {
+	size, err := c.size(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if size <= 0 || !c.canResume(ctx) {
+		c.debug("can't retrieve %s in segments, falling back to Retrieve", path)
+		return c.RetrieveContext(ctx, path, &offsetWriter{w: dest})
+	}
+
+	if int64(segments) > size {
+		segments = int(size)
+	}
+
+	if segments < 1 {
+		segments = 1
+	}
+
+	segmentSize := (size + int64(segments) - 1) / int64(segments)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		total    int64
+		firstErr error
+	)
+
+	for offset := int64(0); offset < size; offset += segmentSize {
+		length := segmentSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		wg.Add(1)
+		go func(offset, length int64) {
+			defer wg.Done()
+
+			n, err := c.retrieveSegment(ctx, path, dest, offset, length, size)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			total += n
+
+			if err != nil && firstErr == nil {
+				firstErr = err
+				// no point finishing the other segments
+				cancel()
+			}
+		}(offset, length)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if total != size {
+		return ftpError{
+			err:       fmt.Errorf("expected %d bytes, got %d", size, total),
+			temporary: true,
+		}
+	}
+
+	return nil
+}
+
+// maxSegmentAttempts bounds the attempts in a row a segment may make
+// without retrieving any bytes.
+const maxSegmentAttempts = 3
+
+// retrieveSegment writes the "length" bytes of file "path" starting at
+// "offset" to dest, resuming as long as it keeps making progress and
+// retrying up to maxSegmentAttempts times when it doesn't.
+func (c *Client) retrieveSegment(ctx context.Context, path string, dest io.WriterAt, offset, length, size int64) (int64, error) {
+	var (
+		bytesSoFar int64
+		attempts   int
+	)
+	for {
+		n, err := c.retrieveRange(ctx, path, dest, offset+bytesSoFar, length-bytesSoFar, size)
+
+		bytesSoFar += n
+
+		if err == nil {
+			return bytesSoFar, nil
+		} else if ctx.Err() != nil {
+			return bytesSoFar, err
+		}
+
+		if n > 0 {
+			attempts = 0
+		} else if attempts++; attempts >= maxSegmentAttempts {
+			return bytesSoFar, err
+		}
+
+		c.debug("retrying segment at %d of %s after error: %s", offset+bytesSoFar, path, err)
+	}
+}
+
+// retrieveRange makes a single attempt at writing the "length" bytes of file
+// "path" starting at "offset" to dest.
+func (c *Client) retrieveRange(ctx context.Context, path string, dest io.WriterAt, offset, length, size int64) (int64, error) {
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.returnConn(pconn)
+
+	dc, err := pconn.openTransfer("RETR", path, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	// to catch early returns
+	defer dc.Close()
+
+	n, err := io.Copy(&offsetWriter{w: dest, offset: offset}, io.LimitReader(dc, length))
+	if err != nil {
+		pconn.abandonTransfer("RETR", dc)
+		return n, pconn.contextError(err)
+	}
+
+	if n < length {
+		pconn.abandonTransfer("RETR", dc)
+		return n, ftpError{
+			err:       fmt.Errorf("expected %d bytes at offset %d, got %d", length, offset, n),
+			temporary: true,
+		}
+	}
+
+	return n, pconn.finishRetrieveRange(dc, offset+length == size)
+}
+
+// offsetWriter adapts an io.WriterAt to an io.Writer writing from offset
+// onwards.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.w.WriteAt(p, ow.offset)
+	ow.offset += int64(n)
+	return n, err
+}
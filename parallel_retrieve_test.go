@@ -0,0 +1,119 @@
+package goftp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// writerAtBuffer is an in-memory io.WriterAt. If failAt is positive, the
+// first write covering that offset fails part way through.
+type writerAtBuffer struct {
+	mu     sync.Mutex
+	buf    []byte
+	failAt int64
+}
+
+func (w *writerAtBuffer) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	end := off + int64(len(p))
+	if w.failAt > 0 && off <= w.failAt && w.failAt < end {
+		n := copy(w.buf[off:], p[:w.failAt-off])
+		w.failAt = 0
+		return n, errors.New("too many bytes to handle")
+	}
+
+	return copy(w.buf[off:], p), nil
+}
+
+func TestRetrieveParallel(t *testing.T) {
+	buf := make([]byte, 5*1024*1024+3)
+	randomBytes(buf)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/segmented", buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := ioutil.TempFile("", "goftp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		err = c.RetrieveParallel("git-ignored/segmented", f, 4)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, got) {
+			t.Errorf("buf was %d, got %d", len(buf), len(got))
+		}
+
+		err = c.RetrieveParallel("doesnt-exist", &writerAtBuffer{}, 4)
+		if err == nil {
+			t.Error("Expected error about not existing")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestRetrieveParallelResumeSegment(t *testing.T) {
+	buf := make([]byte, 1024*1024)
+	randomBytes(buf)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/segmented", buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// fail part way through the third segment, then right at its start
+		for _, failAt := range []int64{600 * 1024, 512 * 1024} {
+			dest := &writerAtBuffer{
+				buf:    make([]byte, len(buf)),
+				failAt: failAt,
+			}
+
+			err = c.RetrieveParallel("git-ignored/segmented", dest, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if dest.failAt != 0 {
+				t.Error("Write didn't fail")
+			}
+
+			if !bytes.Equal(buf, dest.buf) {
+				t.Error("Got wrong bytes")
+			}
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
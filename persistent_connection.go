@@ -6,12 +6,14 @@ package goftp
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
 	"net/textproto"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -43,6 +45,20 @@ type persistentConn struct {
 	// data socket (tracked so we can close it on client.Close())
 	dataConn net.Conn
 
+	// guards controlConn, dataConn and transferring, which are used from
+	// another goroutine when the connection's context is done
+	mu sync.Mutex
+
+	// a RETR/STOR/APPE is in progress on dataConn, so it can be aborted
+	// without giving up the control connection (see setContext)
+	transferring bool
+
+	// context of the operation currently using this connection
+	ctx context.Context
+
+	// stops watching ctx (see setContext)
+	stopWatching func()
+
 	// control socket read/write helpers
 	reader *textproto.Reader
 	writer *textproto.Writer
@@ -66,6 +82,13 @@ type persistentConn struct {
 	// tracks the current type (e.g. ASCII/Image) of connection
 	currentType string
 
+	// algorithm currently selected for the HASH command
+	hashAlgo string
+
+	// throttles data connections: the Client's shared limiter, unless
+	// overridden for the transfer at hand
+	limiter *bandwidthLimiter
+
 	host string
 }
 
@@ -86,14 +109,25 @@ func (pconn *persistentConn) Close() error {
 }
 
 func (pconn *persistentConn) setControlConn(conn net.Conn) {
+	pconn.mu.Lock()
 	pconn.controlConn = conn
+	pconn.mu.Unlock()
 	pconn.reader = textproto.NewReader(bufio.NewReader(conn))
 	pconn.writer = textproto.NewWriter(bufio.NewWriter(conn))
 }
 
+func (pconn *persistentConn) setDataConn(conn net.Conn) {
+	pconn.mu.Lock()
+	pconn.dataConn = conn
+	pconn.mu.Unlock()
+}
+
 func (pconn *persistentConn) close() error {
 	pconn.debug("closing")
 
+	pconn.mu.Lock()
+	defer pconn.mu.Unlock()
+
 	if pconn.dataConn != nil {
 		// ignore "already closed" error since typically the user of dataConn will
 		// close it, but we still want to make sure it's closed here
@@ -107,6 +141,87 @@ func (pconn *persistentConn) close() error {
 	return nil
 }
 
+// setContext binds the connection to ctx until clearContext is called. If ctx
+// is done in the meantime, the connection is closed to interrupt whatever it
+// is blocked on. During a transfer only the data connection is closed; the
+// transfer is then aborted with ABOR (see abort), which keeps the control
+// connection usable.
+func (pconn *persistentConn) setContext(ctx context.Context) {
+	pconn.ctx = ctx
+
+	if ctx.Done() == nil {
+		pconn.stopWatching = nil
+		return
+	}
+
+	var (
+		stop        = make(chan struct{})
+		finished    = make(chan struct{})
+		interrupted bool
+	)
+
+	go func() {
+		defer close(finished)
+		select {
+		case <-ctx.Done():
+			pconn.debug("interrupting: %s", ctx.Err())
+			if pconn.interruptTransfer() {
+				return
+			}
+			interrupted = true
+			pconn.close()
+		case <-stop:
+		}
+	}()
+
+	pconn.stopWatching = func() {
+		close(stop)
+		<-finished
+		if interrupted {
+			pconn.broken = true
+		}
+	}
+}
+
+// interruptTransfer closes the data connection of the transfer in progress,
+// if any.
+func (pconn *persistentConn) interruptTransfer() bool {
+	pconn.mu.Lock()
+	defer pconn.mu.Unlock()
+
+	if !pconn.transferring || pconn.dataConn == nil {
+		return false
+	}
+
+	pconn.dataConn.Close()
+	return true
+}
+
+// setTransferring notes whether a transfer is in progress on dataConn.
+func (pconn *persistentConn) setTransferring(transferring bool) {
+	pconn.mu.Lock()
+	pconn.transferring = transferring
+	pconn.mu.Unlock()
+}
+
+// clearContext undoes setContext.
+func (pconn *persistentConn) clearContext() {
+	if pconn.stopWatching != nil {
+		pconn.stopWatching()
+		pconn.stopWatching = nil
+	}
+	pconn.ctx = context.Background()
+}
+
+// contextError returns an error describing why the connection's context is
+// done, or err if it isn't done.
+func (pconn *persistentConn) contextError(err error) error {
+	if pconn.ctx.Err() != nil {
+		return contextError(pconn.ctx)
+	}
+	return err
+}
+
 func (pconn *persistentConn) sendCommandExpected(expected int, f string, args ...interface{}) error {
 	code, msg, err := pconn.sendCommand(f, args...)
 	if err != nil {
@@ -145,16 +260,8 @@ func (pconn *persistentConn) sendCommand(f string, args ...interface{}) (int, st
 		}
 	}
 
-	pconn.controlConn.SetWriteDeadline(time.Now().Add(pconn.config.Timeout))
-	err := pconn.writer.PrintfLine("%s", cmd)
-
-	if err != nil {
-		pconn.broken = true
-		pconn.debug(`error sending command "%s": %s`, logName, err)
-		return 0, "", ftpError{
-			err:       fmt.Errorf("error writing command: %s", err),
-			temporary: true,
-		}
+	if err := pconn.writeCommand(cmd, logName); err != nil {
+		return 0, "", err
 	}
 
 	code, msg, err := pconn.readResponse()
@@ -167,16 +274,33 @@ func (pconn *persistentConn) sendCommand(f string, args ...interface{}) (int, st
 	return code, msg, err
 }
 
+// writeCommand sends cmd without waiting for the response.
+func (pconn *persistentConn) writeCommand(cmd, logName string) error {
+	pconn.controlConn.SetWriteDeadline(time.Now().Add(pconn.config.Timeout))
+	err := pconn.writer.PrintfLine("%s", cmd)
+
+	if err != nil {
+		pconn.broken = true
+		pconn.debug(`error sending command "%s": %s`, logName, err)
+		return pconn.contextError(ftpError{
+			err:       fmt.Errorf("error writing command: %s", err),
+			temporary: true,
+		})
+	}
+
+	return nil
+}
+
 func (pconn *persistentConn) readResponse() (int, string, error) {
 	pconn.controlConn.SetReadDeadline(time.Now().Add(pconn.config.Timeout))
 	code, msg, err := pconn.reader.ReadResponse(0)
 	if err != nil {
 		pconn.broken = true
 		pconn.debug("error reading response: %s", err)
-		err = ftpError{
+		err = pconn.contextError(ftpError{
 			err:       fmt.Errorf("error reading response: %s", err),
 			temporary: true,
-		}
+		})
 	}
 	return code, msg, err
 }
@@ -351,16 +475,57 @@ PASV:
 type dataConn struct {
 	net.Conn
 	Timeout time.Duration
+
+	// throttles reads and writes if non-nil
+	limiter *bandwidthLimiter
+
+	// interrupts waiting on limiter
+	ctx context.Context
 }
 
 func (c *dataConn) Read(buf []byte) (int, error) {
+	buf = buf[:c.limiter.chunkSize(len(buf))]
+
 	c.Conn.SetReadDeadline(time.Now().Add(c.Timeout))
-	return c.Conn.Read(buf)
+	n, err := c.Conn.Read(buf)
+
+	if waitErr := c.limiter.wait(c.ctx, n); err == nil {
+		err = waitErr
+	}
+
+	return n, err
 }
 
 func (c *dataConn) Write(buf []byte) (int, error) {
-	c.Conn.SetWriteDeadline(time.Now().Add(c.Timeout))
-	return c.Conn.Write(buf)
+	var written int
+	for len(buf) > 0 {
+		chunk := buf[:c.limiter.chunkSize(len(buf))]
+
+		if err := c.limiter.wait(c.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		c.Conn.SetWriteDeadline(time.Now().Add(c.Timeout))
+		n, err := c.Conn.Write(chunk)
+		written += n
+
+		if err != nil {
+			return written, err
+		}
+
+		buf = buf[n:]
+	}
+
+	return written, nil
+}
+
+func (pconn *persistentConn) newDataConn(conn net.Conn) *dataConn {
+	return &dataConn{
+		Conn:    conn,
+		Timeout: pconn.config.Timeout,
+		limiter: pconn.limiter,
+		ctx:     pconn.ctx,
+	}
 }
 
 func (pconn *persistentConn) prepareDataConn() (func() (net.Conn, error), error) {
@@ -393,10 +558,7 @@ func (pconn *persistentConn) prepareDataConn() (func() (net.Conn, error), error)
 				pconn.debug("upgraded active connection to TLS")
 			}
 
-			pconn.dataConn = &dataConn{
-				Conn:    dc,
-				Timeout: pconn.config.Timeout,
-			}
+			pconn.setDataConn(pconn.newDataConn(dc))
 			return pconn.dataConn, nil
 		}, nil
 	} else {
@@ -406,14 +568,17 @@ func (pconn *persistentConn) prepareDataConn() (func() (net.Conn, error), error)
 		}
 
 		pconn.debug("opening data connection to %s", host)
-		dc, netErr := net.DialTimeout("tcp", host, pconn.config.Timeout)
+		dialer := &net.Dialer{
+			Timeout: pconn.config.Timeout,
+		}
+		dc, netErr := dialer.DialContext(pconn.ctx, "tcp", host)
 
 		if netErr != nil {
 			var isTemporary bool
 			if ne, ok := netErr.(net.Error); ok {
 				isTemporary = ne.Temporary()
 			}
-			return nil, ftpError{err: netErr, temporary: isTemporary}
+			return nil, pconn.contextError(ftpError{err: netErr, temporary: isTemporary})
 		}
 
 		if pconn.config.TLSConfig != nil {
@@ -422,10 +587,7 @@ func (pconn *persistentConn) prepareDataConn() (func() (net.Conn, error), error)
 		}
 
 		return func() (net.Conn, error) {
-			pconn.dataConn = &dataConn{
-				Conn:    dc,
-				Timeout: pconn.config.Timeout,
-			}
+			pconn.setDataConn(pconn.newDataConn(dc))
 			return pconn.dataConn, nil
 		}, nil
 	}
@@ -546,6 +708,33 @@ func (pconn *persistentConn) setClient(client string) error {
 	return nil
 }
 
+// setMLSTFacts asks for all the facts the server supports with "OPTS MLST",
+// as servers may leave some out of MLST/MLSD entries by default.
+func (pconn *persistentConn) setMLSTFacts() error {
+	// "type*;size*;modify*;UNIX.mode;unique;", where "*" marks enabled facts
+	var facts []string
+	for _, fact := range strings.Split(pconn.features["MLST"], ";") {
+		if fact = strings.TrimSuffix(strings.TrimSpace(fact), "*"); fact != "" {
+			facts = append(facts, fact+";")
+		}
+	}
+
+	if len(facts) == 0 {
+		return nil
+	}
+
+	code, msg, err := pconn.sendCommand("OPTS MLST %s", strings.Join(facts, ""))
+	if err != nil {
+		return err
+	}
+
+	if !positiveCompletionReply(code) {
+		pconn.debug("server doesn't support OPTS MLST: %d-%s", code, msg)
+	}
+
+	return nil
+}
+
 func (pconn *persistentConn) setUnicode() error {
 	code, msg, err := pconn.sendCommand("OPTS UTF8 ON")
 	if err != nil {
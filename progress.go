@@ -0,0 +1,137 @@
+package goftp
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Progress describes how far along a Retrieve or Store is.
+type Progress struct {
+	// Path of the file being transferred.
+	Path string
+
+	// Number of bytes of the file transferred so far, including bytes
+	// transferred by earlier attempts.
+	BytesTransferred int64
+
+	// Expected size of the file, or -1 if unknown. Retrieve gets it from the
+	// SIZE command. Store knows it if the source reports its size, as
+	// *os.File, *bytes.Reader and *strings.Reader do.
+	Total int64
+
+	// Offset the current attempt resumed the transfer from, 0 for the first
+	// attempt.
+	ResumeOffset int64
+
+	// Number of the current attempt, starting at 1 and increasing each time
+	// an interrupted transfer is resumed.
+	Attempt int
+}
+
+// ProgressFunc receives progress updates during a transfer. It is called
+// from the goroutine running the transfer, which waits for it to return.
+type ProgressFunc func(Progress)
+
+// WithProgress sets the function notified of a transfer's progress,
+// overriding Config.Progress. Updates are sent at most every
+// Config.ProgressInterval while data flows, plus once at the end of each
+// attempt.
+func WithProgress(fn ProgressFunc) TransferOption {
+	return func(o *transferOptions) {
+		o.progress = fn
+	}
+}
+
+// progressTracker keeps track of a transfer's progress across attempts. A
+// nil *progressTracker tracks nothing.
+type progressTracker struct {
+	fn       ProgressFunc
+	interval time.Duration
+	last     time.Time
+	progress Progress
+}
+
+func newProgressTracker(fn ProgressFunc, interval time.Duration, path string, total int64) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+
+	return &progressTracker{
+		fn:       fn,
+		interval: interval,
+		progress: Progress{Path: path, Total: total},
+	}
+}
+
+// startAttempt records the start of an attempt at offset.
+func (pt *progressTracker) startAttempt(offset int64) {
+	if pt == nil {
+		return
+	}
+
+	pt.progress.Attempt++
+	pt.progress.ResumeOffset = offset
+	pt.progress.BytesTransferred = offset
+	pt.last = time.Now()
+}
+
+func (pt *progressTracker) add(n int) {
+	if pt == nil {
+		return
+	}
+
+	pt.progress.BytesTransferred += int64(n)
+
+	if time.Since(pt.last) >= pt.interval {
+		pt.report()
+	}
+}
+
+func (pt *progressTracker) report() {
+	if pt == nil {
+		return
+	}
+
+	pt.last = time.Now()
+	pt.fn(pt.progress)
+}
+
+type progressReader struct {
+	io.Reader
+	tracker *progressTracker
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.Reader.Read(p)
+	pr.tracker.add(n)
+	return n, err
+}
+
+type progressWriter struct {
+	io.Writer
+	tracker *progressTracker
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.Writer.Write(p)
+	pw.tracker.add(n)
+	return n, err
+}
+
+// sourceSize returns the number of bytes src has to offer, or -1 if it
+// can't tell.
+func sourceSize(src io.Reader) int64 {
+	switch s := src.(type) {
+	case interface{ Len() int }:
+		return int64(s.Len())
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := s.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		return info.Size()
+	}
+
+	return -1
+}
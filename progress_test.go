@@ -0,0 +1,136 @@
+package goftp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRetrieveProgress(t *testing.T) {
+	buf := make([]byte, 1024*1024)
+	randomBytes(buf)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/progress", buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		config := goftpConfig
+		config.ProgressInterval = time.Nanosecond
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var updates []Progress
+		err = c.Retrieve("git-ignored/progress", ioutil.Discard, WithProgress(func(p Progress) {
+			updates = append(updates, p)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(updates) < 2 {
+			t.Fatalf("Got %d updates", len(updates))
+		}
+
+		for i := 1; i < len(updates); i++ {
+			if updates[i].BytesTransferred < updates[i-1].BytesTransferred {
+				t.Errorf("Progress went backwards: %+v", updates[i])
+			}
+		}
+
+		expected := Progress{
+			Path:             "git-ignored/progress",
+			BytesTransferred: int64(len(buf)),
+			Total:            int64(len(buf)),
+			Attempt:          1,
+		}
+		if last := updates[len(updates)-1]; last != expected {
+			t.Errorf("Got %+v", last)
+		}
+	}
+}
+
+func TestRetrieveProgressResume(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(testWriter)
+		buf.cb = func(p []byte) (int, error) {
+			if len(p) <= 2 {
+				return len(p), nil
+			}
+			c.Close()
+			c.closed = false
+			return 2, errors.New("too many bytes to handle")
+		}
+
+		var updates []Progress
+		err = c.Retrieve("subdir/1234.bin", buf, WithProgress(func(p Progress) {
+			updates = append(updates, p)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// one update at the end of each attempt
+		expected := []Progress{
+			{Path: "subdir/1234.bin", BytesTransferred: 2, Total: 4, Attempt: 1},
+			{Path: "subdir/1234.bin", BytesTransferred: 4, Total: 4, ResumeOffset: 2, Attempt: 2},
+		}
+		if len(updates) != len(expected) || updates[0] != expected[0] || updates[1] != expected[1] {
+			t.Errorf("Got %+v", updates)
+		}
+	}
+}
+
+func TestStoreProgress(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		var updates []Progress
+
+		config := goftpConfig
+		config.Progress = func(p Progress) {
+			updates = append(updates, p)
+		}
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Remove("testroot/git-ignored/foo")
+
+		err = c.Store("git-ignored/foo", bytes.NewReader([]byte{1, 2, 3, 4}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := Progress{
+			Path:             "git-ignored/foo",
+			BytesTransferred: 4,
+			Total:            4,
+			Attempt:          1,
+		}
+		if len(updates) != 1 || updates[0] != expected {
+			t.Errorf("Got %+v", updates)
+		}
+
+		// the option overrides the config
+		err = c.Store("git-ignored/foo", bytes.NewReader([]byte{1, 2, 3, 4}), WithProgress(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(updates) != 1 {
+			t.Errorf("Got %+v", updates)
+		}
+	}
+}
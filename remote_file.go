@@ -0,0 +1,244 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// File provides random access to a file on the server without downloading
+// all of it. It implements io.Reader, io.ReaderAt, io.Seeker and io.Closer,
+// so for example a remote zip archive can be opened with
+// zip.NewReader(f, f.Size()).
+//
+// Each read that isn't satisfied by the read-ahead cache issues REST and
+// RETR on one of the Client's pooled connections, then aborts the transfer
+// once it has the bytes it needs. Reading at an offset other than zero
+// requires the server to support "REST STREAM".
+//
+// ReadAt may be called concurrently. Read and Seek share the file's offset
+// and should not be called concurrently with each other.
+type File struct {
+	client    *Client
+	ctx       context.Context
+	path      string
+	size      int64
+	canResume bool
+
+	// ReadAhead is the minimum number of bytes fetched by a single
+	// transfer. Bytes beyond those requested are kept for later reads,
+	// which makes small sequential reads much cheaper. ReadAhead is 0
+	// (no read-ahead) by default and must be set before the first read.
+	ReadAhead int
+
+	mu sync.Mutex
+
+	// offset for Read and Seek
+	offset int64
+
+	// read-ahead cache holding the bytes starting at cacheOffset
+	cache       []byte
+	cacheOffset int64
+
+	closed bool
+}
+
+// OpenFile opens file "path" on the server for random access. The file's
+// size is fetched up front (using SIZE if the server supports it) and is
+// assumed not to change while the file is open.
+func (c *Client) OpenFile(path string) (*File, error) {
+	return c.OpenFileContext(context.Background(), path)
+}
+
+// OpenFileContext is like OpenFile, but reads from the returned File fail
+// once ctx is done.
+func (c *Client) OpenFileContext(ctx context.Context, path string) (*File, error) {
+	size, err := c.size(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == -1 {
+		info, err := c.StatContext(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.IsDir() {
+			return nil, ftpError{err: fmt.Errorf("%s is a directory", path)}
+		}
+
+		size = info.Size()
+	}
+
+	return &File{
+		client:    c,
+		ctx:       ctx,
+		path:      path,
+		size:      size,
+		canResume: c.canResume(ctx),
+	}, nil
+}
+
+// Name returns the path the file was opened with.
+func (f *File) Name() string {
+	return f.path
+}
+
+// Size returns the size of the file when it was opened.
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// ReadAt reads len(p) bytes starting at offset off. Following the
+// io.ReaderAt contract, it returns io.EOF if fewer bytes were read because
+// the file ended.
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ftpError{err: errors.New("negative offset")}
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return 0, ftpError{err: errors.New("read from closed file")}
+	}
+	readAhead := f.ReadAhead
+	cache, cacheOffset := f.cache, f.cacheOffset
+	f.mu.Unlock()
+
+	if len(p) == 0 {
+		return 0, nil
+	} else if off >= f.size {
+		return 0, io.EOF
+	}
+
+	want := int64(len(p))
+	if off+want > f.size {
+		want = f.size - off
+	}
+
+	var n int
+	if off >= cacheOffset && off+want <= cacheOffset+int64(len(cache)) {
+		n = copy(p[:want], cache[off-cacheOffset:])
+	} else {
+		fetch := want
+		if int64(readAhead) > fetch {
+			fetch = int64(readAhead)
+			if off+fetch > f.size {
+				fetch = f.size - off
+			}
+		}
+
+		buf := make([]byte, fetch)
+		if err := f.fetch(buf, off); err != nil {
+			return 0, err
+		}
+
+		if fetch > want {
+			f.mu.Lock()
+			f.cache, f.cacheOffset = buf, off
+			f.mu.Unlock()
+		}
+
+		n = copy(p, buf[:want])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// fetch fills buf with the file's contents starting at off.
+func (f *File) fetch(buf []byte, off int64) error {
+	if off > 0 && !f.canResume {
+		return ftpError{err: errors.New("server doesn't support REST STREAM")}
+	}
+
+	pconn, err := f.client.getIdleConn(f.ctx)
+	if err != nil {
+		return err
+	}
+
+	defer f.client.returnConn(pconn)
+
+	dc, err := pconn.openTransfer("RETR", f.path, off)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(dc, buf); err != nil {
+		pconn.abandonTransfer("RETR", dc)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ftpError{err: fmt.Errorf("file shrank to less than %d bytes", off+int64(len(buf)))}
+		}
+		return pconn.contextError(ftpError{err: err, temporary: true})
+	}
+
+	return pconn.finishRetrieveRange(dc, off+int64(len(buf)) == f.size)
+}
+
+// Read reads up to len(p) bytes from the file's current offset.
+func (f *File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	offset := f.offset
+	f.mu.Unlock()
+
+	n, err := f.ReadAt(p, offset)
+
+	f.mu.Lock()
+	f.offset = offset + int64(n)
+	f.mu.Unlock()
+
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+// Seek sets the offset for the next Read, interpreted according to whence
+// as per io.Seeker.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, ftpError{err: errors.New("seek on closed file")}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, ftpError{err: fmt.Errorf("invalid whence %d", whence)}
+	}
+
+	if offset < 0 {
+		return 0, ftpError{err: errors.New("negative offset")}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+// Close releases the read-ahead cache. The file can't be read afterwards.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return ftpError{err: errors.New("file already closed")}
+	}
+
+	f.closed = true
+	f.cache = nil
+	return nil
+}
@@ -0,0 +1,191 @@
+package goftp
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileZip(t *testing.T) {
+	zipBuf := new(bytes.Buffer)
+	zw := zip.NewWriter(zipBuf)
+
+	// incompressible filler so the central directory is far from the start
+	filler := make([]byte, 1024*1024)
+	randomBytes(filler)
+
+	for name, data := range map[string][]byte{"filler": filler, "hello.txt": []byte("hello world")} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile("testroot/git-ignored/test.zip", zipBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := c.OpenFile("git-ignored/test.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.Size() != int64(zipBuf.Len()) {
+			t.Errorf("Got size %d", f.Size())
+		}
+
+		zr, err := zip.NewReader(f, f.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found bool
+		for _, zf := range zr.File {
+			if zf.Name != "hello.txt" {
+				continue
+			}
+
+			found = true
+
+			r, err := zf.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != "hello world" {
+				t.Errorf("Got %q", got)
+			}
+		}
+
+		if !found {
+			t.Error("Didn't find hello.txt")
+		}
+
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestFileSeek(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.OpenFile("doesnt-exist")
+		if err == nil {
+			t.Error("Expected error about not existing")
+		}
+
+		f, err := c.OpenFile("subdir/1234.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pos, err := f.Seek(-3, io.SeekEnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pos != 1 {
+			t.Errorf("Got position %d", pos)
+		}
+
+		got, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal([]byte{2, 3, 4}, got) {
+			t.Errorf("Got %v", got)
+		}
+
+		buf := make([]byte, 3)
+		n, err := f.ReadAt(buf, 2)
+		if err != io.EOF || n != 2 || !bytes.Equal([]byte{3, 4}, buf[:n]) {
+			t.Errorf("Got %d %v %v", n, err, buf[:n])
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestFileReadAhead(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		buf := make([]byte, 64*1024)
+		randomBytes(buf)
+
+		if err := ioutil.WriteFile("testroot/git-ignored/readahead", buf, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := c.OpenFile("git-ignored/readahead")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f.ReadAhead = 32 * 1024
+
+		got := make([]byte, 100)
+		if _, err := f.ReadAt(got, 1000); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf[1000:1100], got) {
+			t.Error("Got wrong bytes")
+		}
+
+		// the rest of the read-ahead is served from the cache
+		os.Remove("testroot/git-ignored/readahead")
+
+		if _, err := f.ReadAt(got, 20000); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf[20000:20100], got) {
+			t.Error("Got wrong bytes")
+		}
+
+		if _, err := f.ReadAt(got, 40000); err == nil {
+			t.Error("Expected error reading past the cache")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RemoveAll removes path and any children it contains, like os.RemoveAll.
+// The tree is listed as with Walk, then files are deleted concurrently on up
+// to ConnectionsPerHost connections and directories removed bottom-up.
+// Symbolic links are removed, not followed. Paths that turn out to be gone
+// already, e.g. removed by someone else meanwhile, count as removed, so
+// RemoveAll returns nil if path doesn't exist. Otherwise it keeps going
+// after a failure and returns the first error.
+func (c *Client) RemoveAll(path string) error {
+	return c.RemoveAllContext(context.Background(), path)
+}
+
+// RemoveAllContext is like RemoveAll, but gives up as soon as ctx is done.
+func (c *Client) RemoveAllContext(ctx context.Context, path string) error {
+	var (
+		files, dirs []string
+
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	err := c.WalkContext(ctx, path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == path && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			if ctx.Err() != nil {
+				return err
+			}
+			if err := c.removed(ctx, p, err); err != nil {
+				fail(err)
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			dirs = append(dirs, p)
+		} else {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.removeEntries(ctx, files, dirs, func(p string, err error) {
+		if err != nil {
+			fail(err)
+		}
+	})
+
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+
+	return firstErr
+}
+
+// removeEntries deletes files concurrently on up to ConnectionsPerHost
+// connections, then removes dirs, deepest first. done is called, possibly
+// concurrently, with the outcome for each entry. Entries already gone count
+// as removed.
+func (c *Client) removeEntries(ctx context.Context, files, dirs []string, done func(p string, err error)) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < c.config.ConnectionsPerHost; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				done(p, c.removed(ctx, p, c.DeleteContext(ctx, p)))
+			}
+		}()
+	}
+
+	for _, p := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- p
+	}
+	close(jobs)
+	wg.Wait()
+
+	dirs = append([]string(nil), dirs...)
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+
+	for _, p := range dirs {
+		if ctx.Err() != nil {
+			return
+		}
+		done(p, c.removed(ctx, p, c.RmdirContext(ctx, p)))
+	}
+}
+
+// removed filters the error of removing p, dropping 550s for paths that
+// don't exist (anymore). Servers also reply 550 if permission is denied, so
+// p is checked for with Lstat.
+func (c *Client) removed(ctx context.Context, p string, err error) error {
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if _, statErr := c.LstatContext(ctx, p); errors.Is(statErr, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,81 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func TestRemoveAll(t *testing.T) {
+	memFS := goftptest.NewMemFS()
+	for _, name := range []string{"build/a", "build/sub/b", "build/sub/deeper/c", "build/sub/deeper/d", "keep/e", "file"} {
+		if err := memFS.WriteFile(name, []byte("lorem"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := memFS.MkdirAll("build/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(memFS)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, name := range []string{"build", "file", "missing"} {
+		if err := c.RemoveAll(name); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		if _, err := memFS.Stat("/" + name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	if _, err := memFS.Stat("/keep/e"); err != nil {
+		t.Error(err)
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	memFS := goftptest.NewMemFS()
+	if err := memFS.WriteFile("file", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(memFS)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	notFound := ftpError{code: 550, msg: "No such file or directory."}
+
+	if err := c.removed(ctx, "missing", notFound); err != nil {
+		t.Errorf("got %v", err)
+	}
+
+	// a 550 for a file that's still there, e.g. for lack of permission
+	if err := c.removed(ctx, "file", notFound); err == nil {
+		t.Error("expected error")
+	}
+
+	if err := c.removed(ctx, "missing", ftpError{code: 553}); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,191 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// maximum number of symbolic links Stat follows, as on Linux
+const maxSymlinks = 40
+
+// Stat is like Lstat, but follows symbolic links, describing the file they
+// point to under the link's name. Link targets come from "MLST"/"LIST" (see
+// Readlink) and are relative to the link's directory. If the target isn't
+// listed, or can't be reached (e.g. an absolute target outside of a chroot),
+// the server resolves the link itself: it is a directory if "CWD" into it
+// works, otherwise "SIZE" and "MDTM" give its size and ModTime.
+func (c *Client) Stat(path string) (os.FileInfo, error) {
+	return c.StatContext(context.Background(), path)
+}
+
+// StatContext is like Stat, but gives up as soon as ctx is done.
+func (c *Client) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := c.LstatContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info, nil
+	}
+
+	target := name
+	for hops := 0; info.Mode()&os.ModeSymlink != 0; hops++ {
+		if hops == maxSymlinks {
+			return nil, ftpError{err: &fs.PathError{Op: "stat", Path: name, Err: errors.New("too many levels of symbolic links")}}
+		}
+
+		link := linkTarget(info)
+		if link == "" {
+			break
+		}
+
+		if !path.IsAbs(link) {
+			link = path.Join(path.Dir(target), link)
+		}
+
+		linked, err := c.LstatContext(ctx, link)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, contextError(ctx)
+			}
+			c.debug("error following link %s to %s: %s", target, link, err)
+			break
+		}
+
+		// "LIST" of a directory lists its contents instead
+		if linked.Name() != path.Base(link) {
+			c.debug("error following link %s to %s: got %s", target, link, linked.Name())
+			break
+		}
+
+		target, info = link, linked
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		// let the server follow the link
+		info, err = c.probeLink(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// named after the link, like os.Stat
+	return namedFileInfo{info, path.Base(name)}, nil
+}
+
+// probeLink finds out what the symbolic link name points to by using it
+// like the file it points to.
+func (c *Client) probeLink(ctx context.Context, name string) (os.FileInfo, error) {
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	isDir, err := pconn.isDir(name)
+	c.returnConn(pconn)
+	if err != nil {
+		return nil, err
+	}
+
+	if isDir {
+		return &ftpFile{name: path.Base(name), mode: os.ModeDir | 0500}, nil
+	}
+
+	size, err := c.size(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	mtime, err := c.ModTimeContext(ctx, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// dangling link
+			return nil, ftpError{err: &fs.PathError{Op: "stat", Path: name, Err: err}}
+		}
+		if ctx.Err() != nil {
+			return nil, contextError(ctx)
+		}
+		c.debug("error getting ModTime of %s: %s", name, err)
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	return &ftpFile{name: path.Base(name), size: size, mtime: mtime, mode: 0400}, nil
+}
+
+// isDir reports whether "CWD" into name works, changing back to the current
+// working directory afterwards.
+func (pconn *persistentConn) isDir(name string) (bool, error) {
+	code, msg, err := pconn.sendCommand("PWD")
+	if err != nil {
+		return false, err
+	}
+
+	if code != replyDirCreated {
+		return false, ftpError{code: code, msg: msg}
+	}
+
+	wd, err := extractDirName(msg)
+	if err != nil {
+		return false, err
+	}
+
+	code, msg, err = pconn.sendCommand("CWD %s", name)
+	if err != nil {
+		return false, err
+	}
+
+	if code != replyFileActionOkay {
+		pconn.debug("CWD into %s failed, assuming it's not a dir: %d-%s", name, code, msg)
+		return false, nil
+	}
+
+	if err := pconn.sendCommandExpected(replyFileActionOkay, "CWD %s", wd); err != nil {
+		// relative paths would go astray
+		pconn.broken = true
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Readlink returns the target of the symbolic link path as listed by the
+// server, in "MLST"'s "OS.unix=slink:target" fact or as "name -> target" in
+// "LIST" output. It fails with ErrNotSupported if the server doesn't list
+// targets.
+func (c *Client) Readlink(path string) (string, error) {
+	return c.ReadlinkContext(context.Background(), path)
+}
+
+// ReadlinkContext is like Readlink, but gives up as soon as ctx is done.
+func (c *Client) ReadlinkContext(ctx context.Context, path string) (string, error) {
+	info, err := c.LstatContext(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", ftpError{err: &fs.PathError{Op: "readlink", Path: path, Err: errors.New("not a symbolic link")}}
+	}
+
+	target := linkTarget(info)
+	if target == "" {
+		return "", ftpError{err: &fs.PathError{Op: "readlink", Path: path, Err: fmt.Errorf("%w: link target not listed", ErrNotSupported)}}
+	}
+
+	return target, nil
+}
+
+func linkTarget(info os.FileInfo) string {
+	if link, ok := info.(LinkInfo); ok {
+		return link.LinkTarget()
+	}
+	return ""
+}
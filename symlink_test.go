@@ -0,0 +1,150 @@
+package goftp
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func TestSymlinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "goftp-symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "file.txt"), []byte("lorem"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	links := map[string]string{
+		"flink":    "file.txt",
+		"dlink":    "dir",
+		"chain":    "flink",
+		"uplink":   "../file.txt",
+		"dangling": "missing",
+		"loop":     "loop",
+		// only the server can follow these, see probeLink
+		"abs":    filepath.Join(root, "file.txt"),
+		"absdir": filepath.Join(root, "dir"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../file.txt", filepath.Join(root, "dir", "uplink")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, disabled := range [][]string{nil, {"MLST"}} {
+		server := goftptest.NewUnstartedServer(goftptest.Dir(root))
+		server.Disabled = disabled
+		server.Start()
+
+		c, err := Dial(server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"flink", "chain", "dir/uplink", "abs"} {
+			info, err := c.Stat(name)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			if info.Name() != filepath.Base(name) || info.Size() != 5 || !info.Mode().IsRegular() {
+				t.Errorf("%v %s: got %s %d %s", disabled, name, info.Name(), info.Size(), info.Mode())
+			}
+		}
+
+		for _, name := range []string{"dlink", "absdir"} {
+			info, err := c.Stat(name)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			if info.Name() != name || !info.IsDir() {
+				t.Errorf("%v %s: got %s %s", disabled, name, info.Name(), info.Mode())
+			}
+		}
+
+		if _, err := c.Stat("dangling"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%v: got %v", disabled, err)
+		} else if _, ok := err.(Error); !ok {
+			t.Errorf("%v: got %T", disabled, err)
+		}
+
+		if _, err := c.Stat("loop"); err == nil {
+			t.Errorf("%v: expected error", disabled)
+		} else if _, ok := err.(Error); !ok {
+			t.Errorf("%v: got %T", disabled, err)
+		}
+
+		info, err := c.Lstat("flink")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%v: got %s", disabled, info.Mode())
+		}
+
+		target, err := c.Readlink("chain")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if target != "flink" {
+			t.Errorf("%v: got %q", disabled, target)
+		}
+
+		if _, err := c.Readlink("file.txt"); err == nil {
+			t.Errorf("%v: expected error", disabled)
+		} else if _, ok := err.(Error); !ok {
+			t.Errorf("%v: got %T", disabled, err)
+		}
+
+		list, err := c.ReadDir("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found int
+		for _, info := range list {
+			target, ok := links[info.Name()]
+			if !ok {
+				continue
+			}
+
+			found++
+			if info.Mode()&os.ModeSymlink == 0 || info.(LinkInfo).LinkTarget() != target {
+				t.Errorf("%v %s: got %s", disabled, info.Name(), info.Mode())
+			}
+		}
+
+		if found != len(links) {
+			t.Errorf("%v: found %d links", disabled, found)
+		}
+
+		// the CWD probe changes back
+		if wd, err := c.Getwd(); err != nil || wd != "/" {
+			t.Errorf("%v: got %q %v", disabled, wd, err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+
+		c.Close()
+		server.Close()
+	}
+}
@@ -5,35 +5,112 @@
 package goftp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
 	"os"
 	"strconv"
+	"time"
 )
 
+// TransferOption configures a single Retrieve or Store call.
+type TransferOption func(*transferOptions)
+
+type transferOptions struct {
+	progress        ProgressFunc
+	limiter         *bandwidthLimiter
+	verifyHash      string
+	preserveModTime bool
+	setMode         bool
+	mode            os.FileMode
+}
+
+// transferOptions applies opts on top of the defaults from the Client's
+// Config.
+func (c *Client) transferOptions(opts []TransferOption) transferOptions {
+	o := transferOptions{
+		progress: c.config.Progress,
+		limiter:  c.limiter,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithPreserveModTime makes Store set the remote file's modification time
+// (see Chtimes) to that of the source once the upload succeeds. The source
+// must have a Stat method, as *os.File does.
+func WithPreserveModTime() TransferOption {
+	return func(o *transferOptions) {
+		o.preserveModTime = true
+	}
+}
+
+// WithMode makes Store or Append apply mode to the remote file (see Chmod)
+// once the upload succeeds, e.g. to make uploaded scripts executable.
+func WithMode(mode os.FileMode) TransferOption {
+	return func(o *transferOptions) {
+		o.setMode = true
+		o.mode = mode
+	}
+}
+
 // Retrieve file "path" from server and write bytes to "dest". If the
 // server supports resuming stream transfers, Retrieve will continue
 // resuming a failed download as long as it continues making progress.
 // Retrieve will also verify the file's size after the transfer if the
-// server supports the SIZE command.
-func (c *Client) Retrieve(path string, dest io.Writer) error {
+// server supports the SIZE command. Options such as WithProgress,
+// WithBandwidthLimit and WithVerifyHash customize the transfer.
+func (c *Client) Retrieve(path string, dest io.Writer, opts ...TransferOption) error {
+	return c.RetrieveContext(context.Background(), path, dest, opts...)
+}
+
+// RetrieveContext is like Retrieve, but gives up as soon as ctx is done,
+// aborting a transfer in progress.
+func (c *Client) RetrieveContext(ctx context.Context, path string, dest io.Writer, opts ...TransferOption) error {
+	return c.retrieveFrom(ctx, path, dest, 0, c.transferOptions(opts))
+}
+
+// retrieveFrom is RetrieveContext for a dest already holding the first
+// offset bytes of the file, which the server must be able to resume from.
+func (c *Client) retrieveFrom(ctx context.Context, path string, dest io.Writer, offset int64, o transferOptions) error {
 	// fetch file size to check against how much we transferred
-	size, err := c.size(path)
+	size, err := c.size(ctx, path)
 	if err != nil {
 		return err
 	}
 
-	canResume := c.canResume()
+	progress := newProgressTracker(o.progress, c.config.ProgressInterval, path, size)
+
+	h, err := o.newTransferHash()
+	if err != nil {
+		return err
+	}
+
+	if h != nil {
+		if offset > 0 {
+			return ftpError{err: errors.New("can't verify the hash of a resumed download")}
+		}
+		dest = &hashingWriter{w: dest, h: h}
+	}
+
+	canResume := c.canResume(ctx)
 
-	var bytesSoFar int64
+	bytesSoFar := offset
 	for {
-		n, err := c.transferFromOffset(path, dest, nil, bytesSoFar)
+		n, err := c.transferFromOffset(ctx, "RETR", path, dest, nil, bytesSoFar, progress, o.limiter)
 
 		bytesSoFar += n
 
 		if err == nil {
 			break
-		} else if n == 0 {
+		} else if n == 0 || ctx.Err() != nil {
 			return err
 		} else if !canResume {
 			return ftpError{
@@ -50,33 +127,150 @@ func (c *Client) Retrieve(path string, dest io.Writer) error {
 		}
 	}
 
-	return nil
+	return c.verifyHash(ctx, path, o.verifyHash, h)
 }
 
-// Store bytes read from "src" into file "path" on the server. If the
-// server supports resuming stream transfers and "src" is an io.Seeker
-// (*os.File is an io.Seeker), Store will continue resuming a failed upload
-// as long as it continues making progress. Store will not attempt to
-// resume an upload if the client is connected to multiple servers. Store
-// will also verify the remote file's size after the transfer if the server
-// supports the SIZE command.
-func (c *Client) Store(path string, src io.Reader) error {
+// Open starts retrieving file "path" from the server and returns a reader
+// streaming its contents. The reader holds on to one of the Client's
+// connections until it is closed, so callers must always call Close. Close
+// checks the server's response once the whole file has been read; closing
+// the reader earlier aborts the transfer. Unlike Retrieve, Open neither
+// resumes interrupted transfers nor verifies the file's size.
+func (c *Client) Open(path string) (io.ReadCloser, error) {
+	return c.OpenContext(context.Background(), path)
+}
 
-	canResume := len(c.hosts) == 1 && c.canResume()
+// OpenContext is like Open, but the transfer is interrupted as soon as ctx
+// is done, failing subsequent reads.
+func (c *Client) OpenContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	pconn, err := c.getIdleConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dc, err := pconn.openTransfer("RETR", path, 0)
+	if err != nil {
+		c.returnConn(pconn)
+		return nil, err
+	}
+
+	return &retrieveReader{client: c, pconn: pconn, dc: dc}, nil
+}
+
+// retrieveReader is the io.ReadCloser returned by Open.
+type retrieveReader struct {
+	client *Client
+	pconn  *persistentConn
+	dc     net.Conn
+	eof    bool
+	closed bool
+}
+
+func (r *retrieveReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, ftpError{err: errors.New("read from closed reader")}
+	}
+
+	n, err := r.dc.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	} else if err != nil {
+		// Close aborts the transfer
+		err = r.pconn.contextError(ftpError{err: err, temporary: true})
+	}
+
+	return n, err
+}
+
+func (r *retrieveReader) Close() error {
+	if r.closed {
+		return ftpError{err: errors.New("reader already closed")}
+	}
+
+	r.closed = true
+
+	defer r.client.returnConn(r.pconn)
+
+	if r.pconn.broken {
+		r.dc.Close()
+		return nil
+	}
+
+	if !r.eof {
+		return r.pconn.abort(r.dc)
+	}
+
+	return r.pconn.finishTransfer("RETR", r.dc)
+}
+
+// Store bytes read from "src" into file "path" on the server. If "src" is
+// an io.Seeker (*os.File is an io.Seeker), Store will continue resuming a
+// failed upload as long as it continues making progress, using "REST" if
+// the server supports resuming stream transfers and "APPE" otherwise.
+// Store will not attempt to resume an upload if the client is connected to
+// multiple servers. Store will also verify the remote file's size after the
+// transfer if the server supports the SIZE command. Options such as
+// WithProgress, WithBandwidthLimit and WithVerifyHash customize the
+// transfer.
+func (c *Client) Store(path string, src io.Reader, opts ...TransferOption) error {
+	return c.StoreContext(context.Background(), path, src, opts...)
+}
+
+// StoreContext is like Store, but gives up as soon as ctx is done, aborting
+// a transfer in progress.
+func (c *Client) StoreContext(ctx context.Context, path string, src io.Reader, opts ...TransferOption) error {
+	return c.store(ctx, path, src, c.transferOptions(opts))
+}
+
+func (c *Client) store(ctx context.Context, path string, src io.Reader, o transferOptions) error {
+	progress := newProgressTracker(o.progress, c.config.ProgressInterval, path, sourceSize(src))
+
+	// without "REST STREAM", resume by appending the rest of src
+	cmd, resumeCmd := "STOR", "STOR"
+	if !c.canResume(ctx) {
+		resumeCmd = "APPE"
+	}
+
+	canResume := len(c.hosts) == 1
 
 	seeker, ok := src.(io.Seeker)
 	if !ok {
 		canResume = false
 	}
 
+	var modTime time.Time
+	if o.preserveModTime {
+		statter, ok := src.(interface{ Stat() (os.FileInfo, error) })
+		if !ok {
+			return ftpError{err: errors.New("can't preserve mtime of a source without a Stat method")}
+		}
+
+		info, err := statter.Stat()
+		if err != nil {
+			return ftpError{err: err}
+		}
+
+		modTime = info.ModTime()
+	}
+
+	h, err := o.newTransferHash()
+	if err != nil {
+		return err
+	}
+
+	var hashingSrc *hashingReader
+	if h != nil {
+		hashingSrc = &hashingReader{r: src, h: h}
+		src = hashingSrc
+	}
+
 	var (
 		bytesSoFar int64
-		err        error
 		n          int64
 	)
 	for {
 		if bytesSoFar > 0 {
-			size, sizeErr := c.size(path)
+			size, sizeErr := c.size(ctx, path)
 			if sizeErr != nil {
 				return ftpError{
 					err:       sizeErr,
@@ -103,14 +297,22 @@ func (c *Client) Store(path string, src io.Reader) error {
 				}
 			}
 			bytesSoFar = size
+
+			if hashingSrc != nil {
+				hashingSrc.pos = size
+			}
+
+			cmd = resumeCmd
 		}
 
-		n, err = c.transferFromOffset(path, nil, src, bytesSoFar)
+		n, err = c.transferFromOffset(ctx, cmd, path, nil, src, bytesSoFar, progress, o.limiter)
 
 		bytesSoFar += n
 
 		if err == nil {
 			break
+		} else if ctx.Err() != nil {
+			return err
 		} else if n == 0 {
 			return ftpError{
 				err:       err,
@@ -125,7 +327,7 @@ func (c *Client) Store(path string, src io.Reader) error {
 	}
 
 	// fetch file size to check against how much we transferred
-	size, err := c.size(path)
+	size, err := c.size(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -136,51 +338,263 @@ func (c *Client) Store(path string, src io.Reader) error {
 		}
 	}
 
+	if err := c.verifyHash(ctx, path, o.verifyHash, h); err != nil {
+		return err
+	}
+
+	if o.setMode {
+		if err := c.ChmodContext(ctx, path, o.mode); err != nil {
+			return err
+		}
+	}
+
+	if o.preserveModTime {
+		return c.ChtimesContext(ctx, path, modTime)
+	}
+
 	return nil
 }
 
-func (c *Client) transferFromOffset(path string, dest io.Writer, src io.Reader, offset int64) (int64, error) {
-	pconn, err := c.getIdleConn()
+// Append appends bytes read from "src" to file "path" on the server using
+// "APPE", creating the file if it doesn't exist. Like Store, Append resumes
+// a failed upload as long as "src" is an io.Seeker and the upload continues
+// making progress, and verifies that the remote file grew by the number of
+// bytes sent if the server supports the SIZE command. WithVerifyHash can't
+// be used with Append, as the server can only hash the whole file.
+func (c *Client) Append(path string, src io.Reader, opts ...TransferOption) error {
+	return c.AppendContext(context.Background(), path, src, opts...)
+}
+
+// AppendContext is like Append, but gives up as soon as ctx is done,
+// aborting a transfer in progress.
+func (c *Client) AppendContext(ctx context.Context, path string, src io.Reader, opts ...TransferOption) error {
+	o := c.transferOptions(opts)
+
+	if o.verifyHash != "" {
+		return ftpError{err: errors.New("can't verify hash of appended data")}
+	}
+
+	// size before appending, -1 if unknown
+	base, err := c.size(ctx, path)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	defer c.returnConn(pconn)
+	if base == -1 {
+		// appending creates missing files
+		if _, statErr := c.StatContext(ctx, path); errors.Is(statErr, fs.ErrNotExist) {
+			base = 0
+		}
+	}
 
-	if err = pconn.setType("I"); err != nil {
-		return 0, err
+	progress := newProgressTracker(o.progress, c.config.ProgressInterval, path, sourceSize(src))
+
+	seeker, canResume := src.(io.Seeker)
+	if len(c.hosts) != 1 || base == -1 {
+		canResume = false
 	}
 
-	if offset > 0 {
-		err := pconn.sendCommandExpected(replyFileActionPending, "REST %d", offset)
+	var (
+		bytesSoFar int64
+		n          int64
+	)
+	for {
+		if bytesSoFar > 0 {
+			size, sizeErr := c.size(ctx, path)
+			if sizeErr != nil {
+				return ftpError{
+					err:       sizeErr,
+					temporary: true,
+				}
+			}
+			if size == -1 || size < base {
+				return ftpError{
+					err:       fmt.Errorf("%s (resume failed)", err),
+					temporary: true,
+				}
+			}
+
+			if _, seekErr := seeker.Seek(size-base, io.SeekStart); seekErr != nil {
+				c.debug("failed seeking to %d while resuming append to %s: %s",
+					size-base,
+					path,
+					seekErr,
+				)
+				return ftpError{
+					err:       fmt.Errorf("%s (resume failed)", err),
+					temporary: true,
+				}
+			}
+			bytesSoFar = size - base
+		}
+
+		n, err = c.transferFromOffset(ctx, "APPE", path, nil, src, bytesSoFar, progress, o.limiter)
+
+		bytesSoFar += n
+
+		if err == nil {
+			break
+		} else if ctx.Err() != nil {
+			return err
+		} else if n == 0 {
+			return ftpError{
+				err:       err,
+				temporary: true,
+			}
+		} else if !canResume {
+			return ftpError{
+				err:       fmt.Errorf("%s (can't resume)", err),
+				temporary: true,
+			}
+		}
+	}
+
+	// check the file grew by how much we transferred
+	if base != -1 {
+		size, err := c.size(ctx, path)
 		if err != nil {
-			return 0, err
+			return err
+		}
+		if size != -1 && size != base+bytesSoFar {
+			return ftpError{
+				err:       fmt.Errorf("appended %d bytes to %d, but size is %d", bytesSoFar, base, size),
+				temporary: true,
+			}
 		}
 	}
 
-	connGetter, err := pconn.prepareDataConn()
+	if o.setMode {
+		if err := c.ChmodContext(ctx, path, o.mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Create starts storing file "path" on the server and returns a writer
+// whose output becomes the file's contents. The writer holds on to one of
+// the Client's connections until it is closed, and the file isn't complete
+// until Close returns successfully. Close checks the server's response and,
+// if the server supports the SIZE command, verifies the remote file's size.
+// Unlike Store, Create doesn't resume interrupted uploads.
+func (c *Client) Create(path string) (io.WriteCloser, error) {
+	return c.CreateContext(context.Background(), path)
+}
+
+// CreateContext is like Create, but the transfer is interrupted as soon as
+// ctx is done, failing subsequent writes.
+func (c *Client) CreateContext(ctx context.Context, path string) (io.WriteCloser, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
-		pconn.debug("error preparing data connection: %s", err)
-		return 0, err
+		return nil, err
 	}
 
-	var cmd string
-	if dest == nil && src != nil {
-		cmd = "STOR"
-	} else if dest != nil && src == nil {
-		cmd = "RETR"
-	} else {
-		panic("this shouldn't happen")
+	dc, err := pconn.openTransfer("STOR", path, 0)
+	if err != nil {
+		c.returnConn(pconn)
+		return nil, err
 	}
 
-	err = pconn.sendCommandExpected(replyGroupPreliminaryReply, "%s %s", cmd, path)
+	return &storeWriter{client: c, ctx: ctx, path: path, pconn: pconn, dc: dc}, nil
+}
+
+// storeWriter is the io.WriteCloser returned by Create.
+type storeWriter struct {
+	client *Client
+	ctx    context.Context
+	path   string
+	pconn  *persistentConn
+	dc     net.Conn
+
+	// bytes written so far
+	n int64
+
+	// first write error
+	err error
+
+	closed bool
+}
+
+func (w *storeWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ftpError{err: errors.New("write to closed writer")}
+	} else if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.dc.Write(p)
+	w.n += int64(n)
+
+	if err != nil {
+		// Close aborts the transfer
+		w.err = w.pconn.contextError(ftpError{err: err, temporary: true})
+		return n, w.err
+	}
+
+	return n, nil
+}
+
+func (w *storeWriter) Close() error {
+	if w.closed {
+		return ftpError{err: errors.New("writer already closed")}
+	}
+
+	w.closed = true
+
+	if w.err != nil {
+		w.pconn.abandonTransfer("STOR", w.dc)
+		w.client.returnConn(w.pconn)
+		return w.err
+	}
+
+	err := w.pconn.finishTransfer("STOR", w.dc)
+	w.client.returnConn(w.pconn)
+	if err != nil {
+		return err
+	}
+
+	size, err := w.client.size(w.ctx, w.path)
+	if err != nil {
+		return err
+	}
+	if size != -1 && size != w.n {
+		return ftpError{
+			err:       fmt.Errorf("sent %d bytes, but size is %d", w.n, size),
+			temporary: true,
+		}
+	}
+
+	return nil
+}
+
+// transferFromOffset runs transfer command cmd ("RETR", "STOR" or "APPE")
+// from offset, which for "APPE" is only used for progress reporting since
+// the server appends to the end of the file anyway.
+func (c *Client) transferFromOffset(ctx context.Context, cmd, path string, dest io.Writer, src io.Reader, offset int64, progress *progressTracker, limiter *bandwidthLimiter) (int64, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	dc, err := connGetter()
+	defer c.returnConn(pconn)
+
+	pconn.limiter = limiter
+	defer func() {
+		pconn.limiter = c.limiter
+	}()
+
+	if (dest == nil) == (src == nil) {
+		panic("this shouldn't happen")
+	}
+
+	restOffset := offset
+	if cmd == "APPE" {
+		restOffset = 0
+	}
+
+	dc, err := pconn.openTransfer(cmd, path, restOffset)
 	if err != nil {
-		pconn.debug("error getting data connection: %s", err)
 		return 0, err
 	}
 
@@ -193,36 +607,158 @@ func (c *Client) transferFromOffset(path string, dest io.Writer, src io.Reader,
 		src = dc
 	}
 
+	if progress != nil {
+		progress.startAttempt(offset)
+		defer progress.report()
+
+		if cmd != "RETR" {
+			src = &progressReader{Reader: src, tracker: progress}
+		} else {
+			dest = &progressWriter{Writer: dest, tracker: progress}
+		}
+	}
+
 	n, err := io.Copy(dest, src)
 
 	if err != nil {
-		pconn.broken = true
-		return n, err
+		pconn.abandonTransfer(cmd, dc)
+		return n, pconn.contextError(err)
+	}
+
+	return n, pconn.finishTransfer(cmd, dc)
+}
+
+// openTransfer sends transfer command "cmd path" in binary mode, preceded by
+// REST if offset is positive, and returns the data connection.
+func (pconn *persistentConn) openTransfer(cmd, path string, offset int64) (net.Conn, error) {
+	if err := pconn.setType("I"); err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		err := pconn.sendCommandExpected(replyFileActionPending, "REST %d", offset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	connGetter, err := pconn.prepareDataConn()
+	if err != nil {
+		pconn.debug("error preparing data connection: %s", err)
+		return nil, err
+	}
+
+	err = pconn.sendCommandExpected(replyGroupPreliminaryReply, "%s %s", cmd, path)
+	if err != nil {
+		return nil, err
 	}
 
-	err = dc.Close()
+	dc, err := connGetter()
 	if err != nil {
+		pconn.debug("error getting data connection: %s", err)
+		return nil, err
+	}
+
+	pconn.setTransferring(true)
+
+	return dc, nil
+}
+
+// finishTransfer closes data connection dc after a complete transfer and
+// checks the server's final response to cmd.
+func (pconn *persistentConn) finishTransfer(cmd string, dc net.Conn) error {
+	pconn.setTransferring(false)
+
+	if err := dc.Close(); err != nil {
 		pconn.debug("error closing data connection: %s", err)
 	}
 
 	code, msg, err := pconn.readResponse()
 	if err != nil {
 		pconn.debug("error reading response after %s: %s", cmd, err)
-		return n, err
+		return err
 	}
 
 	if !positiveCompletionReply(code) {
 		pconn.debug("unexpected response after %s: %d (%s)", cmd, code, msg)
-		return n, ftpError{code: code, msg: msg}
+		return ftpError{code: code, msg: msg}
 	}
 
-	return n, nil
+	return nil
+}
+
+// finishRetrieveRange ends a RETR on dc once the caller has read all the
+// bytes it wants, which are the rest of the file if atEOF is set.
+// Otherwise the transfer is aborted. The bytes read are good either way, so
+// failing to abort only costs the connection.
+func (pconn *persistentConn) finishRetrieveRange(dc net.Conn, atEOF bool) error {
+	if atEOF {
+		var extra [1]byte
+		if _, err := dc.Read(extra[:]); err == io.EOF {
+			return pconn.finishTransfer("RETR", dc)
+		}
+	}
+
+	pconn.abandonTransfer("RETR", dc)
+
+	return nil
+}
+
+// abandonTransfer aborts the transfer on dc, giving up the connection if
+// that fails.
+func (pconn *persistentConn) abandonTransfer(cmd string, dc net.Conn) {
+	if err := pconn.abort(dc); err != nil {
+		pconn.debug("error aborting %s: %s", cmd, err)
+		pconn.broken = true
+	}
+}
+
+// Telnet "Interrupt Process" and "Synch" (IAC IP, IAC DM), sent ahead of
+// ABOR as described in RFC 959.
+const telnetInterrupt = "\xff\xf4\xff\xf2"
+
+// abort closes data connection dc before the transfer is complete and tells
+// the server with ABOR, leaving the connection ready for the next command.
+// As in RFC 959, ABOR is preceded by Telnet IP and Synch. Synch is meant to
+// be sent as TCP urgent data, which isn't available through net.Conn (or
+// TLS), so it goes in-band, which servers accept too. The server usually
+// replies 426 to the interrupted transfer command and 226 to ABOR, but
+// depending on timing the transfer may have completed, and some servers
+// skip one of the two replies, so a NOOP is tacked on to find the end of
+// the replies.
+func (pconn *persistentConn) abort(dc net.Conn) error {
+	pconn.setTransferring(false)
+
+	dc.Close()
+
+	pconn.debug("sending command ABOR")
+
+	if err := pconn.writeCommand(telnetInterrupt+"ABOR", "ABOR"); err != nil {
+		return err
+	}
+
+	if err := pconn.writeCommand("NOOP", "NOOP"); err != nil {
+		return err
+	}
+
+	for {
+		code, msg, err := pconn.readResponse()
+		if err != nil {
+			return err
+		}
+
+		pconn.debug("got %d-%s", code, msg)
+
+		if code == replyCommandOkay {
+			return nil
+		}
+	}
 }
 
 // Fetch SIZE of file. Returns error only on underlying connection error.
 // If the server doesn't support size, it returns -1 and no error.
-func (c *Client) size(path string) (int64, error) {
-	pconn, err := c.getIdleConn()
+func (c *Client) size(ctx context.Context, path string) (int64, error) {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return -1, err
 	}
@@ -257,8 +793,8 @@ func (c *Client) size(path string) (int64, error) {
 	return size, nil
 }
 
-func (c *Client) canResume() bool {
-	pconn, err := c.getIdleConn()
+func (c *Client) canResume(ctx context.Context) bool {
+	pconn, err := c.getIdleConn(ctx)
 	if err != nil {
 		return false
 	}
@@ -6,7 +6,10 @@ package goftp
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -14,6 +17,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/Infiziert90/goftp/goftptest"
 )
 
 func TestRetrieve(t *testing.T) {
@@ -57,6 +62,191 @@ func TestRetrieve(t *testing.T) {
 	}
 }
 
+func TestRetrieveContext(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		buf := new(testWriter)
+		buf.cb = func(p []byte) (int, error) {
+			// cancel part way through the transfer
+			cancel()
+			time.Sleep(50 * time.Millisecond)
+			return 2, errors.New("too many bytes to handle")
+		}
+
+		err = c.RetrieveContext(ctx, "subdir/1234.bin", buf)
+		if err == nil || err.(ftpError).err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+
+		// connection is still okay for later calls
+		got := new(bytes.Buffer)
+		err = c.Retrieve("subdir/1234.bin", got)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal([]byte{1, 2, 3, 4}, got.Bytes()) {
+			t.Errorf("Got %v", got.Bytes())
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Open("doesnt-exist")
+		if err == nil {
+			t.Errorf("Expected error about not existing")
+		}
+
+		r, err := c.Open("subdir/1234.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal([]byte{1, 2, 3, 4}, got) {
+			t.Errorf("Got %v", got)
+		}
+
+		if err := r.Close(); err == nil {
+			t.Error("Expected error closing twice")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestOpenCloseEarly(t *testing.T) {
+	// big enough that the server is still sending when we close
+	buf := make([]byte, 10*1024*1024)
+	randomBytes(buf)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/big", buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		config := goftpConfig
+		config.ConnectionsPerHost = 1
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := c.Open("git-ignored/big")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make([]byte, 1024)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf[:1024], got) {
+			t.Error("Got wrong bytes")
+		}
+
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the aborted connection is reused
+		lorem := new(bytes.Buffer)
+		if err := c.Retrieve("lorem.txt", lorem); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.connIdx != 1 {
+			t.Errorf("Expected one connection, opened %d", c.connIdx)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+// cancelling a transfer aborts it with ABOR instead of giving up the
+// connection
+func TestRetrieveContextAbort(t *testing.T) {
+	buf := make([]byte, 10*1024*1024)
+	randomBytes(buf)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/big", buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		config := goftpConfig
+		config.ConnectionsPerHost = 1
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		dest := new(testWriter)
+		dest.cb = func(p []byte) (int, error) {
+			// cancel part way through the transfer and keep going until
+			// the data connection is closed
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+			return len(p), nil
+		}
+
+		err = c.RetrieveContext(ctx, "git-ignored/big", dest)
+		if err == nil || err.(ftpError).err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+
+		got := new(bytes.Buffer)
+		if err := c.Retrieve("subdir/1234.bin", got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal([]byte{1, 2, 3, 4}, got.Bytes()) {
+			t.Errorf("Got %v", got.Bytes())
+		}
+
+		if c.connIdx != 1 {
+			t.Errorf("Expected one connection, opened %d", c.connIdx)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
 func TestRetrievePASV(t *testing.T) {
 	for _, addr := range ftpdAddrs {
 		if strings.HasPrefix(addr, "[::1]") {
@@ -250,6 +440,151 @@ func TestStore(t *testing.T) {
 	}
 }
 
+func TestStorePreserveModTime(t *testing.T) {
+	mtime := time.Date(2012, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	if err := ioutil.WriteFile("testroot/git-ignored/src", []byte{1, 2, 3, 4}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes("testroot/git-ignored/src", mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		toSend, err := os.Open("testroot/git-ignored/src")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Remove("testroot/git-ignored/foo")
+
+		err = c.Store("git-ignored/foo", toSend, WithPreserveModTime())
+		toSend.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat("testroot/git-ignored/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("Got %s, expected %s", info.ModTime(), mtime)
+		}
+
+		err = c.Store("git-ignored/foo", bytes.NewReader([]byte{1, 2, 3, 4}), WithPreserveModTime())
+		if err == nil {
+			t.Error("Expected error storing source without Stat")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestStoreWithMode(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Remove("testroot/git-ignored/foo")
+
+		err = c.Store("git-ignored/foo", bytes.NewReader([]byte("#!/bin/sh\n")), WithMode(0755))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat("testroot/git-ignored/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode() != 0755 {
+			t.Errorf("Got %s", info.Mode())
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		// one connection to make sure Close gives it back before checking SIZE
+		config := goftpConfig
+		config.ConnectionsPerHost = 1
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Create("does-not-exist/foo")
+		if err == nil {
+			t.Error("Expected error creating in missing directory")
+		}
+
+		os.Remove("testroot/git-ignored/foo.gz")
+
+		w, err := c.Create("git-ignored/foo.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gz := gzip.NewWriter(w)
+		if _, err := gz.Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Close(); err == nil {
+			t.Error("Expected error closing twice")
+		}
+
+		f, err := os.Open("testroot/git-ignored/foo.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gzr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := ioutil.ReadAll(gzr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(stored) != "hello world" {
+			t.Errorf("Got %q", stored)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
 func TestStoreActive(t *testing.T) {
 	for _, addr := range ftpdAddrs {
 		activeConfig := goftpConfig
@@ -330,6 +665,43 @@ func TestStoreError(t *testing.T) {
 	}
 }
 
+// io.Reader that never runs out of bytes, but takes its time handing them
+// out
+type slowReader struct{}
+
+func (slowReader) Read(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	if len(p) > 1024 {
+		p = p[:1024]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestStoreContext(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+		err = c.StoreContext(ctx, "git-ignored/foo", slowReader{})
+		cancel()
+
+		if err == nil || !err.(ftpError).Timeout() {
+			t.Errorf("Expected a timeout error, got %v", err)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
 // io.Reader that also implements io.Seeker interface like
 // *os.File (used to test resuming uploads)
 type testSeeker struct {
@@ -357,6 +729,39 @@ func randomBytes(b []byte) {
 
 // kill connections part way through upload - show we can restart if src
 // is an io.Seeker
+func TestStoreContextAbort(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		config := goftpConfig
+		config.ConnectionsPerHost = 1
+
+		c, err := DialConfig(config, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+		err = c.StoreContext(ctx, "git-ignored/foo", slowReader{})
+		cancel()
+
+		if err == nil || !err.(ftpError).Timeout() {
+			t.Errorf("Expected a timeout error, got %v", err)
+		}
+
+		if _, err := c.Stat("git-ignored/foo"); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.connIdx != 1 {
+			t.Errorf("Expected one connection, opened %d", c.connIdx)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
 func TestResumeStoreOnWriteError(t *testing.T) {
 	for _, addr := range ftpdAddrs {
 		c, err := DialConfig(goftpConfig, addr)
@@ -411,6 +816,151 @@ func TestResumeStoreOnWriteError(t *testing.T) {
 	}
 }
 
+// without "REST STREAM", Store resumes with APPE
+func TestResumeStoreWithAPPE(t *testing.T) {
+	server := goftptest.NewUnstartedServer(goftptest.Dir("testroot"))
+	server.Disabled = []string{"REST"}
+	server.Start()
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	buf := make([]byte, 10*1024*1024)
+	randomBytes(buf)
+
+	closed := false
+
+	seeker := &testSeeker{
+		buf: bytes.NewReader(buf),
+		cb: func(readSoFar int) {
+			if readSoFar > 5*1024*1024 && !closed {
+				time.Sleep(100 * time.Millisecond)
+
+				c.Close()
+				c.closed = false
+				closed = true
+			}
+		},
+	}
+
+	os.Remove("testroot/git-ignored/big")
+
+	// REST is disabled, so resuming only works with APPE
+	if err := c.Store("git-ignored/big", seeker); err != nil {
+		t.Fatal(err)
+	}
+
+	if !closed {
+		t.Fatal("Upload wasn't interrupted")
+	}
+
+	stored, err := ioutil.ReadFile("testroot/git-ignored/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf, stored) {
+		t.Errorf("buf was %d, stored was %d", len(buf), len(stored))
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		os.Remove("testroot/git-ignored/foo")
+
+		// creates the file
+		if err := c.Append("git-ignored/foo", bytes.NewReader([]byte{1, 2})); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Append("git-ignored/foo", bytes.NewReader([]byte{3, 4})); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := ioutil.ReadFile("testroot/git-ignored/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal([]byte{1, 2, 3, 4}, stored) {
+			t.Errorf("Got %v", stored)
+		}
+
+		err = c.Append("git-ignored/foo", bytes.NewReader([]byte{5}), WithVerifyHash(HashSHA256))
+		if err == nil {
+			t.Error("Expected error verifying hash of appended data")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+// kill connections part way through an append, which resumes from where
+// the remote file ends
+func TestResumeAppendOnWriteError(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		prefix := []byte("existing data\n")
+		if err := ioutil.WriteFile("testroot/git-ignored/big", prefix, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, 10*1024*1024)
+		randomBytes(buf)
+
+		closed := false
+
+		seeker := &testSeeker{
+			buf: bytes.NewReader(buf),
+			cb: func(readSoFar int) {
+				if readSoFar > 5*1024*1024 && !closed {
+					time.Sleep(100 * time.Millisecond)
+
+					c.Close()
+					c.closed = false
+					closed = true
+				}
+			},
+		}
+
+		if err := c.Append("git-ignored/big", seeker); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := ioutil.ReadFile("testroot/git-ignored/big")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(append(prefix, buf...), stored) {
+			t.Errorf("buf was %d, stored was %d", len(prefix)+len(buf), len(stored))
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
 func TestEmptyLinesFeat(t *testing.T) {
 	for _, addr := range ftpdAddrs {
 		c, err := DialConfig(goftpConfig, addr)
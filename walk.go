@@ -0,0 +1,226 @@
+package goftp
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Walk walks the file tree rooted at "root", calling walkFn for each file or
+// directory in the tree, including root. It follows the semantics of
+// filepath.Walk: returning filepath.SkipDir from walkFn skips a directory
+// (or the rest of the containing directory when returned for a file), and
+// when a directory can't be read walkFn is called a second time for it with
+// the error. Entries named "." or "..", or whose name contains a slash, are
+// left out, as they would lead the walk out of the tree.
+//
+// Directories are listed concurrently on up to ConnectionsPerHost pooled
+// connections, ahead of the walk reaching them. walkFn is still called from
+// the calling goroutine, in the same lexical order as filepath.Walk, so the
+// visiting order and the error returned don't depend on which listing
+// finishes first. The first non-SkipDir error returned by walkFn stops the
+// walk, and Walk returns it once listings in flight have finished.
+func (c *Client) Walk(root string, walkFn filepath.WalkFunc) error {
+	return c.WalkContext(context.Background(), root, walkFn)
+}
+
+// WalkContext is like Walk, but gives up as soon as ctx is done. Pending
+// directories are then reported to walkFn with the context's error.
+func (c *Client) WalkContext(ctx context.Context, root string, walkFn filepath.WalkFunc) error {
+	info, err := c.LstatContext(ctx, root)
+	if err != nil {
+		if err := walkFn(root, nil, err); err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+
+	err = walkFn(root, info, nil)
+	if err == filepath.SkipDir {
+		return nil
+	} else if err != nil || !info.IsDir() {
+		return err
+	}
+
+	w := &walker{
+		client: c,
+		ctx:    ctx,
+		walkFn: walkFn,
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	for i := 0; i < c.config.ConnectionsPerHost; i++ {
+		w.wg.Add(1)
+		go w.fetch()
+	}
+	defer w.close()
+
+	return w.walkDir(root, info, w.prefetch([]string{root})[0])
+}
+
+type walker struct {
+	client *Client
+	ctx    context.Context
+	walkFn filepath.WalkFunc
+
+	wg sync.WaitGroup
+
+	// guards everything below, cond signals changes to it
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// listings yet to be fetched, the one needed soonest last
+	pending []*listing
+
+	closed bool
+}
+
+// listing is a directory's listing, fetched before the walk reaches the
+// directory.
+type listing struct {
+	dir     string
+	done    chan struct{}
+	entries []os.FileInfo
+	err     error
+
+	// no longer needed, guarded by walker.mu
+	skipped bool
+}
+
+// prefetch queues listings of dirs, which the walk will visit in the given
+// order after everything queued so far.
+func (w *walker) prefetch(dirs []string) []*listing {
+	listings := make([]*listing, len(dirs))
+	for i, dir := range dirs {
+		listings[i] = &listing{dir: dir, done: make(chan struct{})}
+	}
+
+	w.mu.Lock()
+	for i := len(listings) - 1; i >= 0; i-- {
+		w.pending = append(w.pending, listings[i])
+	}
+	w.mu.Unlock()
+	w.cond.Broadcast()
+
+	return listings
+}
+
+// skip drops l if it hasn't been fetched yet.
+func (w *walker) skip(l *listing) {
+	w.mu.Lock()
+	l.skipped = true
+	w.mu.Unlock()
+}
+
+// fetch fetches pending listings until the walker is closed.
+func (w *walker) fetch() {
+	defer w.wg.Done()
+
+	for {
+		w.mu.Lock()
+		for len(w.pending) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		l := w.pending[len(w.pending)-1]
+		w.pending = w.pending[:len(w.pending)-1]
+		skipped := l.skipped
+		w.mu.Unlock()
+
+		if skipped {
+			continue
+		}
+
+		l.entries, l.err = w.client.ReadDirContext(w.ctx, l.dir)
+		sort.Slice(l.entries, func(i, j int) bool {
+			return l.entries[i].Name() < l.entries[j].Name()
+		})
+		close(l.done)
+	}
+}
+
+// close stops fetching listings and waits for those in flight.
+func (w *walker) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.cond.Broadcast()
+
+	w.wg.Wait()
+}
+
+// walkDir walks the entries of dir, whose listing is l, and returns the
+// error that stopped the walk, if any.
+func (w *walker) walkDir(dir string, info os.FileInfo, l *listing) error {
+	<-l.done
+
+	if l.err != nil {
+		if err := w.walkFn(dir, info, l.err); err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+
+	// servers may list the directory itself, its parent or worse under
+	// names that lead back up the tree
+	entries := l.entries[:0:0]
+	for _, entry := range l.entries {
+		if name := entry.Name(); name == "." || name == ".." || strings.Contains(name, "/") ||
+			path.Dir(path.Join(dir, name)) != path.Clean(dir) {
+			w.client.debug("skipping entry %q of %s", name, dir)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	var subdirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subdirs = append(subdirs, path.Join(dir, entry.Name()))
+		}
+	}
+	listings := w.prefetch(subdirs)
+
+	// whatever isn't walked below won't be needed
+	defer func() {
+		for _, sub := range listings {
+			w.skip(sub)
+		}
+	}()
+
+	for _, entry := range entries {
+		entryPath := path.Join(dir, entry.Name())
+
+		var sub *listing
+		if entry.IsDir() {
+			sub, listings = listings[0], listings[1:]
+		}
+
+		err := w.walkFn(entryPath, entry, nil)
+		if err == filepath.SkipDir {
+			if entry.IsDir() {
+				w.skip(sub)
+				continue
+			}
+			// skip the rest of this directory
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if err := w.walkDir(entryPath, entry, sub); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
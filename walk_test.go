@@ -0,0 +1,266 @@
+package goftp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Infiziert90/goftp/goftptest"
+)
+
+func TestWalk(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		err = c.Walk("", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// contents vary depending on other tests
+			if path == "git-ignored" {
+				return filepath.SkipDir
+			}
+
+			got = append(got, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Strings(got)
+
+		expected := []string{"", "email%40mail.com.txt", "lorem.txt", "subdir", "subdir/1234.bin"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("got %v", got)
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stop := errors.New("stop")
+
+		var calls int
+		err = c.Walk("", func(path string, info os.FileInfo, err error) error {
+			calls++
+			if path == "email%40mail.com.txt" {
+				return stop
+			}
+			return nil
+		})
+
+		if err != stop {
+			t.Errorf("got %v", err)
+		}
+
+		// root, then the first entry
+		if calls != 2 {
+			t.Errorf("walkFn called %d times after stopping", calls)
+		}
+
+		// missing root is reported to walkFn
+		var gotErr error
+		err = c.Walk("does-not-exist", func(path string, info os.FileInfo, err error) error {
+			gotErr = err
+			return nil
+		})
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if gotErr == nil {
+			t.Error("expected walkFn to see an error")
+		}
+
+		if c.numOpenConns() != len(c.freeConnCh) {
+			t.Error("Leaked a connection")
+		}
+	}
+}
+
+func TestWalkSkipFile(t *testing.T) {
+	for _, addr := range ftpdAddrs {
+		c, err := DialConfig(goftpConfig, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		err = c.Walk("", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			got = append(got, path)
+
+			// skips the rest of the root directory
+			if path == "email%40mail.com.txt" {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, []string{"", "email%40mail.com.txt"}) {
+			t.Errorf("got %v", got)
+		}
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	memFS := goftptest.NewMemFS()
+	for _, name := range []string{"d/x", "c/x", "b/y/x", "b/x", "a/x", "e"} {
+		if err := memFS.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := goftptest.NewServer(memFS)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var got []string
+	err = c.Walk("/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/", "/a", "/a/x", "/b", "/b/x", "/b/y", "/b/y/x", "/c", "/c/x", "/d", "/d/x", "/e"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v", got)
+	}
+
+	// the first error is the one filepath.Walk would return
+	for i := 0; i < 20; i++ {
+		err = c.Walk("/", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return errors.New(path)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "/a/x" {
+			t.Fatalf("got %v", err)
+		}
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}
+
+func TestWalkSkipRoot(t *testing.T) {
+	memFS := goftptest.NewMemFS()
+	if err := memFS.WriteFile("file", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := goftptest.NewServer(memFS)
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// like filepath.Walk, SkipDir isn't returned to the caller
+	for _, root := range []string{"file", "missing"} {
+		err := c.Walk(root, func(path string, info os.FileInfo, err error) error {
+			return filepath.SkipDir
+		})
+		if err != nil {
+			t.Errorf("%s: got %v", root, err)
+		}
+	}
+}
+
+func TestWalkSelfParent(t *testing.T) {
+	memFS := goftptest.NewMemFS()
+	for _, name := range []string{"secret", "sub/a.txt", "sub/deeper/b.txt"} {
+		if err := memFS.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := goftptest.NewServer(hostileFS{memFS})
+	defer server.Close()
+
+	c, err := Dial(server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var got []string
+	err = c.WalkContext(ctx, "sub", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []string{"sub", "sub/a.txt", "sub/deeper", "sub/deeper/b.txt"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v", got)
+	}
+
+	if err := c.RemoveAllContext(ctx, "sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := memFS.Stat("/sub"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v", err)
+	}
+
+	if _, err := memFS.Stat("/secret"); err != nil {
+		t.Error(err)
+	}
+
+	if c.numOpenConns() != len(c.freeConnCh) {
+		t.Error("Leaked a connection")
+	}
+}